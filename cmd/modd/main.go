@@ -4,14 +4,19 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/cortesi/modd"
+	"github.com/cortesi/modd/livereload"
+	"github.com/cortesi/modd/metrics"
 	"github.com/cortesi/modd/notify"
+	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/modd/status"
+	"github.com/cortesi/modd/tui"
 	"github.com/cortesi/termlog"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"mvdan.cc/sh/v3/interp"
-	"mvdan.cc/sh/v3/syntax"
 )
 
 const modfile = "./modd.conf"
@@ -29,6 +34,35 @@ var noconf = kingpin.Flag("noconf", "Don't watch our own config file").
 	Short('c').
 	Bool()
 
+var clear = kingpin.Flag("clear", "Clear the terminal before running commands in response to changes").
+	Bool()
+
+var prefix = kingpin.Flag("prefix", "Prefix each line of command output with a label identifying the command").
+	Bool()
+
+var dashboard = kingpin.Flag("tui", "Show a full-screen dashboard of blocks and daemons").
+	Bool()
+
+var statusPort = kingpin.Flag("status-port", "Serve a status page on localhost at this port").
+	PlaceHolder("PORT").
+	Int()
+
+var liveReload = kingpin.Flag("livereload", "Serve livereload on localhost, for blocks with reload directives").
+	Bool()
+
+var liveReloadPort = kingpin.Flag("livereload-port", "Port for the livereload server").
+	Default(strconv.Itoa(livereload.DefaultPort)).
+	PlaceHolder("PORT").
+	Int()
+
+var metricsPort = kingpin.Flag("metrics-port", "Serve Prometheus metrics on localhost at this port").
+	PlaceHolder("PORT").
+	Int()
+
+var metricsFile = kingpin.Flag("metrics-file", "Write Prometheus metrics to a file on exit").
+	PlaceHolder("PATH").
+	String()
+
 var beep = kingpin.Flag("bell", "Ring terminal bell if any command returns an error").
 	Short('b').
 	Bool()
@@ -41,6 +75,43 @@ var doNotify = kingpin.Flag("notify", "Send stderr to system notification if com
 	Short('n').
 	Bool()
 
+var termStatus = kingpin.Flag("term-status", "Show status in the terminal title, and send terminal notifications").
+	Bool()
+
+var notifyRecovery = kingpin.Flag("notify-recovery", "Send a notification when a block succeeds after a failure").
+	Bool()
+
+var notifySuccess = kingpin.Flag("notify-success", "Send a notification whenever a block succeeds").
+	Bool()
+
+var notifyUrgency = kingpin.Flag("notify-urgency", "Urgency level for libnotify notifications").
+	PlaceHolder("LEVEL").
+	Enum("low", "normal", "critical")
+
+var notifyIcon = kingpin.Flag("notify-icon", "Icon for libnotify notifications").
+	PlaceHolder("PATH").
+	String()
+
+var notifyInterval = kingpin.Flag("notify-interval", "Minimum interval between notifications - repeated notifications are coalesced (0 disables limiting)").
+	Default("0s").
+	Duration()
+
+var notifyCmd = kingpin.Flag("notify-cmd", "Run a command for each notification, with @title, @body and @status variables").
+	PlaceHolder("COMMAND").
+	String()
+
+var webhook = kingpin.Flag("webhook", "POST a JSON description of each notification to a URL").
+	PlaceHolder("URL").
+	String()
+
+var webhookHeaders = kingpin.Flag("webhook-header", "Add a header to webhook requests (repeatable)").
+	PlaceHolder("NAME:VALUE").
+	Strings()
+
+var webhookRetries = kingpin.Flag("webhook-retries", "Number of times to retry a failed webhook request").
+	Default("3").
+	Int()
+
 var prep = kingpin.Flag("prep", "Run prep commands and exit").
 	Short('p').
 	Bool()
@@ -58,27 +129,11 @@ func main() {
 	kingpin.Parse()
 
 	if *exec != "" {
-		parser := syntax.NewParser()
-		prog, err := parser.Parse(strings.NewReader(*exec), "")
-		if err != nil {
-			os.Exit(1)
-		}
-
-		runner, err := interp.New(
-			interp.StdIO(os.Stdin, os.Stdout, os.Stderr),
-			func(r *interp.Runner) error {
-				return nil
-			},
-		)
-		if err != nil {
-			os.Exit(1)
-		}
-
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		runner.Reset()
-		err = runner.Run(ctx, prog)
-		if err != nil {
+		err := shell.RunBuiltin(context.Background(), *exec, os.Stdin, os.Stdout, os.Stderr)
+		if ee, ok := err.(shell.ExitError); ok {
+			os.Exit(ee.Code)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 		os.Exit(0)
@@ -102,26 +157,130 @@ func main() {
 		if n == nil {
 			log.Shout("Could not find a desktop notifier")
 		} else {
+			if ln, ok := n.(*notify.LibnotifyNotifier); ok {
+				ln.Urgency = *notifyUrgency
+				ln.Icon = *notifyIcon
+			}
 			notifiers = append(notifiers, n)
 		}
 	}
 	if *beep {
 		notifiers = append(notifiers, &notify.BeepNotifier{})
 	}
+	if *termStatus {
+		notifiers = append(notifiers, notify.NewTerminalNotifier())
+	}
+	var hook *notify.WebhookNotifier
+	if *webhook != "" {
+		w := notify.NewWebhookNotifier(*webhook)
+		w.Retries = *webhookRetries
+		w.Log = log
+		for _, h := range *webhookHeaders {
+			parts := strings.SplitN(h, ":", 2)
+			if len(parts) != 2 {
+				log.Shout("Invalid webhook header: %q", h)
+				return
+			}
+			w.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		notifiers = append(notifiers, w)
+		hook = w
+	}
+
+	var dash *tui.Dashboard
+	if *dashboard && !*prep {
+		dash = tui.New()
+		notifiers = append(notifiers, dash)
+	}
+
+	var statusServer *status.Server
+	if *statusPort != 0 && !*prep {
+		statusServer = status.New()
+		addr, err := statusServer.Listen(fmt.Sprintf("127.0.0.1:%d", *statusPort))
+		if err != nil {
+			log.Shout("Could not start status page: %s", err)
+			return
+		}
+		log.Notice("Status page at http://%s/", addr)
+		notifiers = append(notifiers, statusServer)
+	}
+
+	var lr *livereload.Server
+	if *liveReload && !*prep {
+		lr = livereload.New()
+		addr, err := lr.Listen(fmt.Sprintf("127.0.0.1:%d", *liveReloadPort))
+		if err != nil {
+			log.Shout("Could not start livereload server: %s", err)
+			return
+		}
+		log.Notice("Livereload script at http://%s/livereload.js", addr)
+	}
+
+	var mtr *metrics.Metrics
+	if *metricsPort != 0 || *metricsFile != "" {
+		mtr = metrics.New()
+		if *metricsFile != "" {
+			// Blocks with indir change the working directory while they run
+			path, err := filepath.Abs(*metricsFile)
+			if err != nil {
+				log.Shout("%s", err)
+				return
+			}
+			*metricsFile = path
+		}
+		if *metricsPort != 0 && !*prep {
+			addr, err := mtr.Listen(fmt.Sprintf("127.0.0.1:%d", *metricsPort))
+			if err != nil {
+				log.Shout("Could not start metrics server: %s", err)
+				return
+			}
+			log.Notice("Metrics at http://%s/metrics", addr)
+		}
+		notifiers = append(notifiers, mtr)
+	}
 
 	mr, err := modd.NewModRunner(*file, log, notifiers, !(*noconf))
 	if err != nil {
 		log.Shout("%s", err)
 		return
 	}
+	mr.Clear = *clear
+	mr.Prefix = *prefix
+	mr.StatusServer = statusServer
+	mr.LiveReload = lr
+	mr.Metrics = mtr
+	mr.MetricsFile = *metricsFile
+	mr.NotifyRecovery = *notifyRecovery
+	mr.NotifySuccess = *notifySuccess
+	mr.NotifyCmd = *notifyCmd
+	mr.NotifyInterval = *notifyInterval
 
 	if *prep {
 		err := mr.PrepOnly(true)
 		if err != nil {
 			log.Shout("%s", err)
 		}
+		if hook != nil {
+			// Deliver notifications before we exit
+			hook.Wait()
+		}
 	} else {
+		if dash != nil {
+			if err := dash.Start(); err != nil {
+				log.Shout("%s", err)
+				return
+			}
+			mr.Log = dash
+			mr.Dashboard = dash
+			if hook != nil {
+				hook.Log = dash
+			}
+		}
 		err = mr.Run()
+		if dash != nil {
+			// Restore the terminal before reporting errors
+			dash.Close()
+		}
 		if err != nil {
 			log.Shout("%s", err)
 		}
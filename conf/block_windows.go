@@ -17,7 +17,16 @@ func (b *Block) addDaemon(command string, options []string) error {
 		RestartSignal: syscall.SIGHUP,
 	}
 	for _, v := range options {
+		name, val := splitOption(v)
+		if ok, err := d.CommandOptions.parse(name, val); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		switch v {
+		case "+stdin":
+			d.Stdin = true
 		case "+sighup":
 			d.RestartSignal = syscall.SIGHUP
 		case "+sigterm":
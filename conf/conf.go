@@ -3,19 +3,80 @@ package conf
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"sort"
+	"strings"
+	"time"
 )
 
+// CommandOptions are options that apply to both daemons and preps
+type CommandOptions struct {
+	Log   string // Path of a file to log command output to
+	Pty   bool   // Run the command attached to a pseudo-terminal
+	Shell string // The shell used to run the command, overriding @shell
+	Name  string // A label identifying the command's output
+
+	Drop      []*regexp.Regexp // Output lines that are not shown
+	Highlight []*regexp.Regexp // Output lines that are highlighted
+}
+
+// parse parses a command option, returning false if it's not an option common
+// to daemons and preps.
+func (o *CommandOptions) parse(name string, val string) (bool, error) {
+	switch name {
+	case "+log":
+		if val == "" {
+			return true, fmt.Errorf("+log requires a path")
+		}
+		// Relative paths are resolved by the parser
+		o.Log = val
+	case "+pty":
+		o.Pty = true
+	case "+shell":
+		if val == "" {
+			return true, fmt.Errorf("+shell requires a shell name")
+		}
+		o.Shell = val
+	case "+name":
+		if val == "" {
+			return true, fmt.Errorf("+name requires a label")
+		}
+		o.Name = val
+	case "+drop", "+highlight":
+		if val == "" {
+			return true, fmt.Errorf("%s requires a pattern", name)
+		}
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return true, fmt.Errorf("invalid %s pattern: %s", name, err)
+		}
+		if name == "+drop" {
+			o.Drop = append(o.Drop, re)
+		} else {
+			o.Highlight = append(o.Highlight, re)
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
 // A Daemon is a persistent process that is kept running
 type Daemon struct {
 	Command       string
 	RestartSignal os.Signal
+	Stdin         bool // Attach modd's stdin to the daemon
+	CommandOptions
 }
 
 // A Prep runs and terminates
 type Prep struct {
 	Command  string
-	Onchange bool // Should prep skip initial run
+	Onchange bool          // Should prep skip initial run
+	NoErr    bool          // Should execution continue if the prep fails
+	Timeout  time.Duration // Maximum run time, or 0 to use the global default
+	Quiet    bool          // Only show output if the prep fails
+	CommandOptions
 }
 
 // Block is a match pattern and a set of specifications
@@ -23,10 +84,22 @@ type Block struct {
 	Include        []string
 	Exclude        []string
 	NoCommonFilter bool
+	Clear          bool // Clear the terminal before running in response to changes
 	InDir          string
+	Shell          string // The shell used by the block's commands, overriding @shell
 
 	Daemons []Daemon
 	Preps   []Prep
+
+	// Hook commands, run after the block's prep commands fail, succeed, or
+	// succeed after a previous failure
+	OnFail    []string
+	OnSuccess []string
+	OnRecover []string
+
+	// Patterns for files that connected browsers reload after the block's
+	// prep commands succeed
+	Reload []string
 }
 
 func (b *Block) addPrep(command string, options []string) error {
@@ -34,22 +107,61 @@ func (b *Block) addPrep(command string, options []string) error {
 		b.Preps = []Prep{}
 	}
 
-	var onchange = false
+	prep := Prep{Command: command}
 	for _, v := range options {
-		switch v {
-		case "+onchange":
-			onchange = true
+		name, val := splitOption(v)
+		if ok, err := prep.CommandOptions.parse(name, val); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch {
+		case v == "+onchange":
+			prep.Onchange = true
+		case v == "+noerr", v == "+continue":
+			prep.NoErr = true
+		case v == "+quiet":
+			prep.Quiet = true
+		case name == "+timeout":
+			d, err := ParseTimeout(val)
+			if err != nil {
+				return err
+			}
+			prep.Timeout = d
 		default:
 			return fmt.Errorf("unknown option: %s", v)
 		}
 	}
 
-	prep := Prep{command, onchange}
-
 	b.Preps = append(b.Preps, prep)
 	return nil
 }
 
+// splitOption splits a command option of the form +name=value into its name
+// and value. The value is empty if the option has none, and is unquoted if
+// necessary.
+func splitOption(opt string) (string, string) {
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	val := parts[1]
+	if len(val) >= 2 && any(rune(val[0]), quotes) {
+		val = unquote(val)
+	}
+	return parts[0], val
+}
+
+// ParseTimeout parses a timeout specification like "30s" or "2m"
+func ParseTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %q", s)
+	}
+	return d, nil
+}
+
 // Config represents a complete configuration
 type Config struct {
 	Blocks    []Block
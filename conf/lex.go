@@ -32,8 +32,12 @@ const (
 	itemEOF
 	itemInDir
 	itemLeftParen
+	itemOnFail
+	itemOnRecover
+	itemOnSuccess
 	itemQuotedString
 	itemPrep
+	itemReload
 	itemRightParen
 	itemSpace
 	itemVarName
@@ -60,10 +64,18 @@ func (i itemType) String() string {
 		return "indir"
 	case itemLeftParen:
 		return "lparen"
+	case itemOnFail:
+		return "onfail"
+	case itemOnRecover:
+		return "onrecover"
+	case itemOnSuccess:
+		return "onsuccess"
 	case itemPrep:
 		return "prep"
 	case itemQuotedString:
 		return "quotedstring"
+	case itemReload:
+		return "reload"
 	case itemRightParen:
 		return "rparen"
 	case itemSpace:
@@ -288,6 +300,21 @@ func (l *lexer) acceptBareString() {
 	)
 }
 
+// acceptOptionValue accepts the value of a +option=value command option. The
+// value can either be bare, or quoted if it contains spaces or colons.
+func (l *lexer) acceptOptionValue() error {
+	if n := l.peek(); any(n, quotes) {
+		l.next()
+		return l.acceptQuotedString(n)
+	}
+	l.acceptFunc(
+		func(r rune) bool {
+			return !any(r, bareStringDisallowed) && r != ':' && r != eof
+		},
+	)
+	return nil
+}
+
 // acceptWord accepts a lowercase word
 func (l *lexer) acceptWord() {
 	l.acceptFunc(
@@ -363,33 +390,42 @@ func lexPatterns(l *lexer) stateFn {
 	}
 }
 
+// lexAssignment lexes a variable assignment, after the leading @ has been
+// consumed. Returns false if an error was emitted.
+func lexAssignment(l *lexer) bool {
+	l.acceptWord()
+	l.emit(itemVarName)
+	n := l.maybeSpace()
+	if n == '=' {
+		l.emit(itemEquals)
+	}
+	n = l.maybeSpace()
+	if n == eof {
+		l.errorf("unterminated variable assignment")
+		return false
+	} else if any(n, quotes) {
+		err := l.acceptQuotedString(n)
+		if err != nil {
+			l.errorf("%s", err)
+			return false
+		}
+		l.emit(itemQuotedString)
+	} else if !any(n, bareStringDisallowed) {
+		l.acceptLine(true)
+		l.emit(itemBareString)
+	} else {
+		l.errorf("= must be followed by a string")
+		return false
+	}
+	return true
+}
+
 // lexVariables reads a block of variable declarations.
 func lexVariables(l *lexer) stateFn {
 	for {
 		n := l.eatSpaceAndComments()
 		if n == '@' {
-			l.acceptWord()
-			l.emit(itemVarName)
-			n = l.maybeSpace()
-			if n == '=' {
-				l.emit(itemEquals)
-			}
-			n = l.maybeSpace()
-			if n == eof {
-				l.errorf("unterminated variable assignment")
-				return nil
-			} else if any(n, quotes) {
-				err := l.acceptQuotedString(n)
-				if err != nil {
-					l.errorf("%s", err)
-					return nil
-				}
-				l.emit(itemQuotedString)
-			} else if !any(n, bareStringDisallowed) {
-				l.acceptLine(true)
-				l.emit(itemBareString)
-			} else {
-				l.errorf("= must be followed by a string")
+			if !lexAssignment(l) {
 				return nil
 			}
 		} else {
@@ -420,6 +456,10 @@ func lexInside(l *lexer) stateFn {
 			return lexTop
 		} else if n == eof {
 			return l.errorf("unterminated block")
+		} else if n == '@' {
+			if !lexAssignment(l) {
+				return nil
+			}
 		} else if !any(n, bareStringDisallowed) {
 			l.acceptWord()
 			switch l.current() {
@@ -429,9 +469,21 @@ func lexInside(l *lexer) stateFn {
 			case "indir":
 				l.emit(itemInDir)
 				return lexOptions
+			case "onfail":
+				l.emit(itemOnFail)
+				return lexOptions
+			case "onrecover":
+				l.emit(itemOnRecover)
+				return lexOptions
+			case "onsuccess":
+				l.emit(itemOnSuccess)
+				return lexOptions
 			case "prep":
 				l.emit(itemPrep)
 				return lexOptions
+			case "reload":
+				l.emit(itemReload)
+				return lexOptions
 			default:
 				l.errorf("unknown directive: %s", l.current())
 				return nil
@@ -454,6 +506,13 @@ func lexOptions(l *lexer) stateFn {
 			return lexCommand
 		} else if n == '+' {
 			l.acceptWord()
+			if l.peek() == '=' {
+				l.next()
+				if err := l.acceptOptionValue(); err != nil {
+					l.errorf("%s", err)
+					return nil
+				}
+			}
 			l.emit(itemBareString)
 		} else {
 			l.errorf("invalid command option")
@@ -136,6 +136,27 @@ var lexTests = []struct {
 			{itemRightParen, "}"},
 		},
 	},
+	{
+		"one {\nprep +timeout=30s: foo\n}", []itm{
+			{itemBareString, "one"},
+			{itemLeftParen, "{"},
+			{itemPrep, "prep"},
+			{itemBareString, "+timeout=30s"},
+			{itemColon, ":"},
+			{itemBareString, "foo\n"},
+			{itemRightParen, "}"},
+		},
+	},
+	{
+		"{\ndaemon +log='my dir/a:b.log': foo\n}", []itm{
+			{itemLeftParen, "{"},
+			{itemDaemon, "daemon"},
+			{itemBareString, "+log='my dir/a:b.log'"},
+			{itemColon, ":"},
+			{itemBareString, "foo\n"},
+			{itemRightParen, "}"},
+		},
+	},
 	{
 		"one { daemon: command\nprep: command\n}", []itm{
 			{itemBareString, "one"},
@@ -256,6 +277,18 @@ var lexTests = []struct {
 			{itemRightParen, "}"},
 		},
 	},
+	{
+		"{\n@shell = bash\nprep: foo\n}", []itm{
+			{itemLeftParen, "{"},
+			{itemVarName, "@shell"},
+			{itemEquals, "="},
+			{itemBareString, "bash\n"},
+			{itemPrep, "prep"},
+			{itemColon, ":"},
+			{itemBareString, "foo\n"},
+			{itemRightParen, "}"},
+		},
+	},
 	{
 		"@W = b", []itm{
 			{itemVarName, "@W"},
@@ -291,6 +324,7 @@ var lexErrorTests = []struct {
 	{"{oink: bar}", "unknown directive: oink", 5},
 	{"! {}", "! must be followed by a string", 2},
 	{"{ daemon +*: foo\n}", "invalid command option", 11},
+	{"{ daemon +log='foo: bar\n}", "unterminated quoted string", 25},
 	{"@foo = \n}", "= must be followed by a string", 9},
 	{"@foo =", "unterminated variable assignment", 6},
 	{"@foo = '", "unterminated quoted string", 8},
@@ -16,6 +16,10 @@ import (
 
 const confVarName = "@confdir"
 
+const shellVarName = "@shell"
+
+const logDirVarName = "@logdir"
+
 type parser struct {
 	name   string
 	text   string
@@ -23,6 +27,9 @@ type parser struct {
 	config *Config
 
 	peekItem *item
+
+	// True if we've seen a daemon that takes stdin
+	stdinClaimed bool
 }
 
 // Dreadfully naive at the moment, but then so is the lexer.
@@ -95,10 +102,9 @@ func (p *parser) collectValues(types ...itemType) []string {
 	return ret
 }
 
-// Collects an arbitrary number of patterns, and returns a (watch, exclude,
-// NoCommonFilter) tuple.
-func (p *parser) collectPatterns() ([]string, []string, bool) {
-	noCommonFilter := false
+// Collects an arbitrary number of patterns and block flags, and stores them in
+// the block.
+func (p *parser) collectPatterns(block *Block) {
 	watch := []string{}
 	exclude := []string{}
 
@@ -109,9 +115,12 @@ func (p *parser) collectPatterns() ([]string, []string, bool) {
 			if v.val[0] == '!' {
 				exclude = append(exclude, v.val[1:])
 			} else {
-				if v.val == "+noignore" {
-					noCommonFilter = true
-				} else {
+				switch v.val {
+				case "+noignore":
+					block.NoCommonFilter = true
+				case "+clear":
+					block.Clear = true
+				default:
 					watch = append(watch, v.val)
 				}
 			}
@@ -123,13 +132,12 @@ func (p *parser) collectPatterns() ([]string, []string, bool) {
 			}
 		}
 	}
-	if len(watch) == 0 {
-		watch = nil
+	if len(watch) > 0 {
+		block.Include = watch
 	}
-	if len(exclude) == 0 {
-		exclude = nil
+	if len(exclude) > 0 {
+		block.Exclude = exclude
 	}
-	return watch, exclude, noCommonFilter
 }
 
 // errorf formats the error and terminates processing.
@@ -179,6 +187,9 @@ func (p *parser) parse() (err error) {
 			if k == "" && v == "" {
 				break
 			}
+			if k == logDirVarName && v != "" {
+				v = p.resolvePath(v)
+			}
 			err = p.config.addVariable(k, v)
 			if err != nil {
 				p.errorf("%s", err)
@@ -215,6 +226,20 @@ func (p *parser) parseVariable() (string, string, error) {
 	return name, val, nil
 }
 
+// resolvePath makes a path from the config file absolute. Relative paths are
+// resolved against the directory containing the config file, so that they
+// don't depend on where modd is run from, or on a block's indir.
+func (p *parser) resolvePath(s string) string {
+	if !filepath.IsAbs(s) {
+		s = filepath.Join(filepath.Dir(p.name), s)
+	}
+	abs, err := filepath.Abs(s)
+	if err != nil {
+		p.errorf("%s", err)
+	}
+	return abs
+}
+
 func prepValue(itm item) string {
 	val := itm.val
 	if itm.typ == itemQuotedString {
@@ -225,7 +250,7 @@ func prepValue(itm item) string {
 
 func (p *parser) parseBlock() *Block {
 	block := &Block{}
-	block.Include, block.Exclude, block.NoCommonFilter = p.collectPatterns()
+	p.collectPatterns(block)
 	nxt := p.next()
 	if nxt.typ != itemLeftParen {
 		p.errorf("expected block open parentheses, got %q", nxt.val)
@@ -234,6 +259,19 @@ Loop:
 	for {
 		nxt = p.next()
 		switch nxt.typ {
+		case itemVarName:
+			p.peekItem = &nxt
+			name, val, err := p.parseVariable()
+			if err != nil {
+				p.errorf("%s", err)
+			}
+			if name != shellVarName {
+				p.errorf("only %s can be set inside a block", shellVarName)
+			}
+			if block.Shell != "" {
+				p.errorf("%s can only be set once per block", shellVarName)
+			}
+			block.Shell = val
 		case itemInDir:
 			options := p.collectValues(itemBareString)
 			if len(options) > 0 {
@@ -253,6 +291,29 @@ Loop:
 				p.errorf("%s", err)
 			}
 			block.InDir = dir
+		case itemOnFail, itemOnRecover, itemOnSuccess:
+			options := p.collectValues(itemBareString)
+			if len(options) > 0 {
+				p.errorf("%s takes no options", nxt.val)
+			}
+			p.mustNext(itemColon)
+			command := prepValue(p.mustNext(itemBareString, itemQuotedString))
+			switch nxt.typ {
+			case itemOnFail:
+				block.OnFail = append(block.OnFail, command)
+			case itemOnRecover:
+				block.OnRecover = append(block.OnRecover, command)
+			case itemOnSuccess:
+				block.OnSuccess = append(block.OnSuccess, command)
+			}
+		case itemReload:
+			options := p.collectValues(itemBareString)
+			if len(options) > 0 {
+				p.errorf("reload takes no options")
+			}
+			p.mustNext(itemColon)
+			patterns := prepValue(p.mustNext(itemBareString, itemQuotedString))
+			block.Reload = append(block.Reload, strings.Fields(patterns)...)
 		case itemDaemon:
 			options := p.collectValues(itemBareString)
 			p.mustNext(itemColon)
@@ -263,6 +324,16 @@ Loop:
 			if err != nil {
 				p.errorf("%s", err)
 			}
+			d := &block.Daemons[len(block.Daemons)-1]
+			if d.Log != "" {
+				d.Log = p.resolvePath(d.Log)
+			}
+			if d.Stdin {
+				if p.stdinClaimed {
+					p.errorf("only one daemon can use +stdin")
+				}
+				p.stdinClaimed = true
+			}
 		case itemPrep:
 			options := p.collectValues(itemBareString)
 			p.mustNext(itemColon)
@@ -273,6 +344,10 @@ Loop:
 			if err != nil {
 				p.errorf("%s", err)
 			}
+			prep := &block.Preps[len(block.Preps)-1]
+			if prep.Log != "" {
+				prep.Log = p.resolvePath(prep.Log)
+			}
 		case itemRightParen:
 			break Loop
 		default:
@@ -2,8 +2,10 @@ package conf
 
 import (
 	"path/filepath"
+	"regexp"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -100,6 +102,19 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"",
+		`foo +clear +noignore {}`,
+		&Config{
+			Blocks: []Block{
+				{
+					Include:        []string{"foo"},
+					NoCommonFilter: true,
+					Clear:          true,
+				},
+			},
+		},
+	},
 	{
 		"",
 		"'foo bar' voing {}",
@@ -118,7 +133,7 @@ var parseTests = []struct {
 			Blocks: []Block{
 				{
 					Include: []string{"foo"},
-					Daemons: []Daemon{{"command", syscall.SIGHUP}},
+					Daemons: []Daemon{{Command: "command", RestartSignal: syscall.SIGHUP}},
 				},
 			},
 		},
@@ -128,29 +143,29 @@ var parseTests = []struct {
 		"{\ndaemon +sighup: c\n}",
 		&Config{
 			Blocks: []Block{
-				{Daemons: []Daemon{{"c", syscall.SIGHUP}}},
+				{Daemons: []Daemon{{Command: "c", RestartSignal: syscall.SIGHUP}}},
 			},
 		},
 	},
 	{
 		"",
 		"{\ndaemon +sigterm: c\n}",
-		&Config{Blocks: []Block{{Daemons: []Daemon{{"c", syscall.SIGTERM}}}}},
+		&Config{Blocks: []Block{{Daemons: []Daemon{{Command: "c", RestartSignal: syscall.SIGTERM}}}}},
 	},
 	{
 		"",
 		"{\ndaemon +sigint: c\n}",
-		&Config{Blocks: []Block{{Daemons: []Daemon{{"c", syscall.SIGINT}}}}},
+		&Config{Blocks: []Block{{Daemons: []Daemon{{Command: "c", RestartSignal: syscall.SIGINT}}}}},
 	},
 	{
 		"",
 		"{\ndaemon +sigkill: c\n}",
-		&Config{Blocks: []Block{{Daemons: []Daemon{{"c", syscall.SIGKILL}}}}},
+		&Config{Blocks: []Block{{Daemons: []Daemon{{Command: "c", RestartSignal: syscall.SIGKILL}}}}},
 	},
 	{
 		"",
 		"{\ndaemon +sigquit: c\n}",
-		&Config{Blocks: []Block{{Daemons: []Daemon{{"c", syscall.SIGQUIT}}}}},
+		&Config{Blocks: []Block{{Daemons: []Daemon{{Command: "c", RestartSignal: syscall.SIGQUIT}}}}},
 	},
 	{
 		"",
@@ -176,6 +191,180 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"",
+		"{\nprep +log=out.log: one\ndaemon +sigterm +log='my dir/out.log': two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Preps: []Prep{
+						Prep{
+							Command:        "one",
+							CommandOptions: CommandOptions{Log: mustAbs("out.log")},
+						},
+					},
+					Daemons: []Daemon{
+						Daemon{
+							Command:        "two",
+							RestartSignal:  syscall.SIGTERM,
+							CommandOptions: CommandOptions{Log: mustAbs("my dir/out.log")},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"{\nprep +pty: one\ndaemon +pty: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Preps: []Prep{
+						Prep{Command: "one", CommandOptions: CommandOptions{Pty: true}},
+					},
+					Daemons: []Daemon{
+						Daemon{
+							Command:        "two",
+							RestartSignal:  syscall.SIGHUP,
+							CommandOptions: CommandOptions{Pty: true},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"@shell = sh\n{\n@shell = fish\nprep: one\n}\n{\nprep: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Shell: "fish",
+					Preps: []Prep{Prep{Command: "one"}},
+				},
+				{
+					Preps: []Prep{Prep{Command: "two"}},
+				},
+			},
+			variables: map[string]string{"@shell": "sh"},
+		},
+	},
+	{
+		"",
+		"{\nprep +shell=exec: one\ndaemon +shell=bash: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Preps: []Prep{
+						Prep{Command: "one", CommandOptions: CommandOptions{Shell: "exec"}},
+					},
+					Daemons: []Daemon{
+						Daemon{
+							Command:        "two",
+							RestartSignal:  syscall.SIGHUP,
+							CommandOptions: CommandOptions{Shell: "bash"},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"{\ndaemon +name=web: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Daemons: []Daemon{
+						Daemon{
+							Command:        "two",
+							RestartSignal:  syscall.SIGHUP,
+							CommandOptions: CommandOptions{Name: "web"},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"{\nprep +quiet +drop=^GET +drop='ping: ok': one\ndaemon +highlight=(?i)error: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Preps: []Prep{
+						Prep{
+							Command: "one",
+							Quiet:   true,
+							CommandOptions: CommandOptions{
+								Drop: []*regexp.Regexp{
+									regexp.MustCompile("^GET"),
+									regexp.MustCompile("ping: ok"),
+								},
+							},
+						},
+					},
+					Daemons: []Daemon{
+						Daemon{
+							Command:       "two",
+							RestartSignal: syscall.SIGHUP,
+							CommandOptions: CommandOptions{
+								Highlight: []*regexp.Regexp{
+									regexp.MustCompile("(?i)error"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"{\ndaemon +stdin +sigterm: one\ndaemon: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Daemons: []Daemon{
+						Daemon{
+							Command:       "one",
+							RestartSignal: syscall.SIGTERM,
+							Stdin:         true,
+						},
+						Daemon{Command: "two", RestartSignal: syscall.SIGHUP},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"foo {\nprep +noerr: one\nprep +continue: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Include: []string{"foo"},
+					Preps: []Prep{
+						Prep{Command: "one", NoErr: true},
+						Prep{Command: "two", NoErr: true},
+					},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"foo {\nprep +timeout=1m30s: command\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Include: []string{"foo"},
+					Preps:   []Prep{Prep{Command: "command", Timeout: 90 * time.Second}},
+				},
+			},
+		},
+	},
 	{
 		"",
 		"foo {\nprep: 'command\n-one\n-two'}",
@@ -188,6 +377,34 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"",
+		"foo {\nprep: command\nonfail: one\nonfail: two\nonsuccess: three\nonrecover: 'four\nfive'\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Include:   []string{"foo"},
+					Preps:     []Prep{Prep{Command: "command"}},
+					OnFail:    []string{"one", "two"},
+					OnSuccess: []string{"three"},
+					OnRecover: []string{"four\nfive"},
+				},
+			},
+		},
+	},
+	{
+		"",
+		"foo {\nprep: command\nreload: static/*.css  static/*.js\nreload: 'index.html'\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Include: []string{"foo"},
+					Preps:   []Prep{Prep{Command: "command"}},
+					Reload:  []string{"static/*.css", "static/*.js", "index.html"},
+				},
+			},
+		},
+	},
 	{
 		"",
 		"foo #comment\nbar\n#comment\n{\n#comment\nprep: command\n}",
@@ -207,7 +424,7 @@ var parseTests = []struct {
 			Blocks: []Block{
 				{
 					Include: []string{"foo", "bar"},
-					Preps:   []Prep{{"command", false}},
+					Preps:   []Prep{{Command: "command"}},
 				},
 			},
 		},
@@ -299,10 +516,40 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"./path/to/modd.conf",
+		"@logdir = logs\n{\nprep +log=out.log: one\ndaemon +log=/var/log/two.log: two\n}",
+		&Config{
+			Blocks: []Block{
+				{
+					Preps: []Prep{
+						{
+							Command:        "one",
+							CommandOptions: CommandOptions{Log: mustAbs("path/to/out.log")},
+						},
+					},
+					Daemons: []Daemon{
+						{
+							Command:        "two",
+							RestartSignal:  syscall.SIGHUP,
+							CommandOptions: CommandOptions{Log: "/var/log/two.log"},
+						},
+					},
+				},
+			},
+			variables: map[string]string{
+				"@confdir": "path/to",
+				"@logdir":  mustAbs("path/to/logs"),
+			},
+		},
+	},
 }
 
 var parseCmpOptions = []cmp.Option{
 	cmp.AllowUnexported(Config{}),
+	cmp.Comparer(func(a, b *regexp.Regexp) bool {
+		return a.String() == b.String()
+	}),
 }
 
 func TestParse(t *testing.T) {
@@ -330,10 +577,24 @@ var parseErrorTests = []struct {
 	{"foo { daemon *: foo }", "test:1: invalid syntax"},
 	{"foo { daemon +invalid: foo }", "test:1: unknown option: +invalid"},
 	{"foo { prep +invalid: foo }", "test:1: unknown option: +invalid"},
+	{"foo { daemon +log=: foo }", "test:1: +log requires a path"},
+	{"foo { prep +shell: foo }", "test:1: +shell requires a shell name"},
+	{"foo { prep +drop: foo }", "test:1: +drop requires a pattern"},
+	{"foo { daemon +name=: foo }", "test:1: +name requires a label"},
+	{"foo { daemon +highlight=(: foo }", "test:1: invalid +highlight pattern: error parsing regexp: missing closing ): `(`"},
+	{"foo { daemon +quiet: foo }", "test:1: unknown option: +quiet"},
+	{"{\n@foo = bar\n}", "test:2: only @shell can be set inside a block"},
+	{"{\n@shell = bash\n@shell = zsh\n}", "test:3: @shell can only be set once per block"},
+	{"foo { prep +timeout=never: foo }", "test:1: invalid timeout: \"never\""},
+	{"foo { prep +onchange=1: foo }", "test:1: unknown option: +onchange=1"},
+	{"foo { prep +stdin: foo }", "test:1: unknown option: +stdin"},
+	{"a {\ndaemon +stdin: foo\n}\nb {\ndaemon +stdin: bar\n}", "test:5: only one daemon can use +stdin"},
 	{"@foo bar {}", "test:1: Expected ="},
 	{"@foo =", "test:1: unterminated variable assignment"},
 	{"@foo=bar\n@foo=bar {}", "test:2: variable @foo shadows previous declaration"},
 	{"{indir +foo: bar\n}", "test:1: indir takes no options"},
+	{"{onfail +foo: bar\n}", "test:1: onfail takes no options"},
+	{"{reload +foo: *.css\n}", "test:1: reload takes no options"},
 	{"{indir: bar\nindir: voing\n}", "test:2: indir can only be used once per block"},
 }
 
@@ -1,12 +1,14 @@
 package modd
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"sync"
 	"time"
 
 	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/notify"
 	"github.com/cortesi/modd/shell"
 	"github.com/cortesi/modd/varcmd"
 	"github.com/cortesi/termlog"
@@ -21,39 +23,92 @@ const (
 	MaxRestart = 8 * time.Second
 )
 
+// stdinRelay forwards modd's stdin to the daemon marked +stdin. There can only
+// be one reader of our stdin, so the relay is shared across config reloads.
+var stdinRelay = sync.OnceValue(func() *shell.StdinRelay {
+	return shell.NewStdinRelay(os.Stdin)
+})
+
 // A single daemon
 type daemon struct {
 	conf  conf.Daemon
 	indir string
 
-	ex    *shell.Executor
-	log   termlog.Stream
-	shell string
-	stop  bool
+	ex      *shell.Executor
+	log     termlog.Stream
+	logfile *shell.LogFile
+	shell   string
+
+	// The daemon's block name, block index and label, for events sent to
+	// notifiers
+	block      string
+	blockIndex int
+	name       string
+	notifiers  []notify.Notifier
+
+	// Cancelling ctx stops the daemon, after which done is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
 	sync.Mutex
 }
 
+// notify sends a daemon event to the StatusNotifiers
+func (d *daemon) notify(e notify.Event) {
+	e.Block = d.block
+	e.BlockIndex = d.blockIndex
+	e.Command = d.conf.Command
+	e.Name = d.name
+	for _, n := range d.notifiers {
+		if _, ok := n.(notify.StatusNotifier); ok {
+			notify.Send(n, e)
+		}
+	}
+}
+
 func (d *daemon) Run() {
+	defer close(d.done)
 	var lastStart time.Time
 	delay := MinRestart
-	for d.stop != true {
+	for d.ctx.Err() == nil {
 		if delay > MinRestart {
 			d.log.Notice(">> restart backoff... %dms", delay/time.Millisecond)
 		}
 		if !lastStart.IsZero() {
-			time.Sleep(delay)
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
 		}
 		d.log.Notice(">> starting...")
 		lastStart = time.Now()
-		err, pstate := d.ex.Run(d.log, false)
+		d.notify(notify.Event{Type: notify.DaemonStart, Title: "daemon started", Start: lastStart})
+		err, pstate := d.ex.RunContext(d.ctx, d.log, false)
 
+		exit := notify.Event{
+			Type:  notify.DaemonExit,
+			Title: "daemon exited",
+			Start: lastStart,
+			End:   time.Now(),
+		}
 		if err != nil {
+			exit.Text = err.Error()
+		} else {
+			exit.Text = pstate.ProcState
+			exit.ExitCode = pstate.ExitCode
+			exit.Signal = pstate.Signal
+		}
+		if d.ctx.Err() != nil {
+			d.notify(exit)
+			return
+		} else if err != nil {
 			d.log.Shout("execution error: %s", err)
 		} else if pstate.Error != nil {
 			if _, ok := pstate.Error.(*exec.ExitError); ok {
 				d.log.Warn("exited: %s", pstate.ProcState)
 			} else {
-				d.log.Shout("exited: %s", err)
+				d.log.Shout("exited: %s", pstate.Error)
 			}
 		} else {
 			d.log.Warn("exited: %s", pstate.ProcState)
@@ -69,6 +124,8 @@ func (d *daemon) Run() {
 				delay = MaxRestart
 			}
 		}
+		exit.Delay = delay.Seconds()
+		d.notify(exit)
 	}
 }
 
@@ -80,6 +137,14 @@ func (d *daemon) Restart() {
 		ex, err := shell.NewExecutor(d.shell, d.conf.Command, d.indir)
 		if err != nil {
 			d.log.Shout("Could not create executor: %s", err)
+			return
+		}
+		ex.LogFile = d.logfile
+		ex.Pty = d.conf.Pty
+		ex.Drop = d.conf.Drop
+		ex.Highlight = d.conf.Highlight
+		if d.conf.Stdin {
+			ex.Stdin = stdinRelay()
 		}
 		d.ex = ex
 		go d.Run()
@@ -94,13 +159,42 @@ func (d *daemon) Restart() {
 	}
 }
 
-func (d *daemon) Shutdown(sig os.Signal) error {
+// stop tells the daemon to stop, sending sig to its process group, and
+// returns a channel that's closed once it has exited, or nil if it was never
+// started. The daemon is killed if it's still running after the executor's
+// grace period.
+func (d *daemon) stop(sig os.Signal) <-chan struct{} {
+	d.Lock()
+	defer d.Unlock()
 	d.log.Notice(">> stopping")
-	d.stop = true
 	if d.ex != nil {
-		return d.ex.Stop()
+		d.ex.CancelSignal = sig
+	}
+	d.cancel()
+	if d.ex == nil {
+		return nil
+	}
+	return d.done
+}
+
+// closeLog closes the daemon's log file. It must only be called once the
+// daemon has exited.
+func (d *daemon) closeLog() {
+	d.Lock()
+	defer d.Unlock()
+	if d.logfile != nil {
+		d.logfile.Close()
+		d.logfile = nil
+	}
+}
+
+// waitAll waits for all of the channels returned by stop to be closed
+func waitAll(done []<-chan struct{}) {
+	for _, c := range done {
+		if c != nil {
+			<-c
+		}
 	}
-	return nil
 }
 
 // DaemonPen is a group of daemons in a single block, managed as a unit.
@@ -109,15 +203,28 @@ type DaemonPen struct {
 	sync.Mutex
 }
 
-// NewDaemonPen creates a new DaemonPen
-func NewDaemonPen(block conf.Block, vars map[string]string, log termlog.TermLog) (*DaemonPen, error) {
+// NewDaemonPen creates a new DaemonPen for block, which is block i in the
+// config
+func NewDaemonPen(
+	i int,
+	block conf.Block,
+	vars map[string]string,
+	labels *Labels,
+	log termlog.TermLog,
+	notifiers []notify.Notifier,
+) (*DaemonPen, error) {
 	d := make([]*daemon, len(block.Daemons))
-	for i, dmn := range block.Daemons {
-		vcmd := varcmd.VarCmd{Block: nil, Modified: nil, Vars: vars}
+	for j, dmn := range block.Daemons {
+		sh, err := commandShell(dmn.CommandOptions, block, vars)
+		if err != nil {
+			return nil, err
+		}
+		vcmd := varcmd.VarCmd{Block: nil, Modified: nil, Vars: vars, Shell: sh}
 		finalcmd, err := vcmd.Render(dmn.Command)
 		if err != nil {
 			return nil, err
 		}
+		label := labels.Label(dmn.CommandOptions, dmn.Command)
 		dmn.Command = finalcmd
 		var indir string
 		if block.InDir != "" {
@@ -128,16 +235,21 @@ func NewDaemonPen(block conf.Block, vars map[string]string, log termlog.TermLog)
 				return nil, err
 			}
 		}
-		sh, err := shell.GetShellName(vars[shellVarName])
-		if err != nil {
-			return nil, err
-		}
 
-		d[i] = &daemon{
-			conf:  dmn,
-			log:   log.Stream(niceHeader("daemon: ", dmn.Command)),
-			shell: sh,
-			indir: indir,
+		ctx, cancel := context.WithCancel(context.Background())
+		d[j] = &daemon{
+			ctx:        ctx,
+			cancel:     cancel,
+			done:       make(chan struct{}),
+			conf:       dmn,
+			log:        commandStream(log, i, block, "daemon", dmn.CommandOptions, label, finalcmd),
+			logfile:    openLog("daemon", dmn.Command, dmn.CommandOptions, vars, log),
+			shell:      sh,
+			indir:      indir,
+			block:      blockName(block),
+			blockIndex: i,
+			name:       label,
+			notifiers:  notifiers,
 		}
 	}
 	return &DaemonPen{daemons: d}, nil
@@ -154,14 +266,42 @@ func (dp *DaemonPen) Restart() {
 	}
 }
 
-// Shutdown all daemons in the pen
+// RestartDaemon restarts the i'th daemon in the pen, or starts it if it's not
+// running yet.
+func (dp *DaemonPen) RestartDaemon(i int) {
+	dp.Lock()
+	defer dp.Unlock()
+	if i >= 0 && i < len(dp.daemons) {
+		dp.daemons[i].Restart()
+	}
+}
+
+// stop tells all daemons in the pen to stop, and returns channels that are
+// closed as they exit
+func (dp *DaemonPen) stop(sig os.Signal) []<-chan struct{} {
+	dp.Lock()
+	defer dp.Unlock()
+	done := []<-chan struct{}{}
+	for _, d := range dp.daemons {
+		done = append(done, d.stop(sig))
+	}
+	return done
+}
+
+// Shutdown all daemons in the pen, and wait for them to exit. The daemons are
+// stopped concurrently, so they share a single grace period.
 func (dp *DaemonPen) Shutdown(sig os.Signal) {
+	waitAll(dp.stop(sig))
+	dp.closeLogs()
+}
+
+// closeLogs closes the log files of all daemons in the pen, once they have
+// exited
+func (dp *DaemonPen) closeLogs() {
 	dp.Lock()
 	defer dp.Unlock()
-	if dp.daemons != nil {
-		for _, d := range dp.daemons {
-			d.Shutdown(sig)
-		}
+	for _, d := range dp.daemons {
+		d.closeLog()
 	}
 }
 
@@ -171,10 +311,12 @@ type DaemonWorld struct {
 }
 
 // NewDaemonWorld creates a DaemonWorld
-func NewDaemonWorld(cnf *conf.Config, log termlog.TermLog) (*DaemonWorld, error) {
+func NewDaemonWorld(
+	cnf *conf.Config, labels *Labels, log termlog.TermLog, notifiers []notify.Notifier,
+) (*DaemonWorld, error) {
 	daemonPens := make([]*DaemonPen, len(cnf.Blocks))
 	for i, b := range cnf.Blocks {
-		d, err := NewDaemonPen(b, cnf.GetVariables(), log)
+		d, err := NewDaemonPen(i, b, cnf.GetVariables(), labels, log, notifiers)
 		if err != nil {
 			return nil, err
 		}
@@ -184,9 +326,14 @@ func NewDaemonWorld(cnf *conf.Config, log termlog.TermLog) (*DaemonWorld, error)
 	return &DaemonWorld{daemonPens}, nil
 }
 
-// Shutdown all daemons with signal s
+// Shutdown all daemons with signal s, and wait for them to exit
 func (dw *DaemonWorld) Shutdown(s os.Signal) {
+	done := []<-chan struct{}{}
+	for _, dp := range dw.DaemonPens {
+		done = append(done, dp.stop(s)...)
+	}
+	waitAll(done)
 	for _, dp := range dw.DaemonPens {
-		dp.Shutdown(s)
+		dp.closeLogs()
 	}
 }
@@ -5,7 +5,10 @@ go 1.25.0
 require (
 	github.com/cortesi/moddwatch v0.1.0
 	github.com/cortesi/termlog v0.0.0-20250523085554-f86697764bb0
+	github.com/fatih/color v1.19.0
 	github.com/google/go-cmp v0.7.0
+	golang.org/x/sys v0.46.0
+	golang.org/x/term v0.44.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	mvdan.cc/sh/v3 v3.11.0
 )
@@ -14,12 +17,9 @@ require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20240927000941-0f3dac36c52b // indirect
 	github.com/bmatcuk/doublestar v1.3.4 // indirect
-	github.com/fatih/color v1.19.0 // indirect
 	github.com/mattn/go-colorable v0.1.15 // indirect
 	github.com/mattn/go-isatty v0.0.22 // indirect
 	github.com/rjeczalik/notify v0.9.3 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
 	golang.org/x/net v0.56.0 // indirect
-	golang.org/x/sys v0.46.0 // indirect
-	golang.org/x/term v0.44.0 // indirect
 )
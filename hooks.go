@@ -0,0 +1,95 @@
+package modd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/notify"
+	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/modd/varcmd"
+	"github.com/cortesi/moddwatch"
+	"github.com/cortesi/termlog"
+)
+
+// hookVars adds the variables available to hook commands in block b to vars.
+// The failure may be nil, in which case the variables are empty.
+func hookVars(vars map[string]string, b conf.Block, failure *ProcError) map[string]string {
+	failedcmd, output, stderr, exitcode := "", "", "", 0
+	if failure != nil {
+		failedcmd = failure.Command
+		output = failure.Output
+		stderr = failure.Stderr
+		exitcode = failure.ExitCode
+	}
+	// The shell has already been validated in ReadConfig
+	sh, _ := blockShell(b, vars)
+	vars["@failedcmd"] = varcmd.QuoteFor(sh, failedcmd)
+	vars["@output"] = varcmd.QuoteFor(sh, output)
+	vars["@stderr"] = varcmd.QuoteFor(sh, stderr)
+	vars["@exitcode"] = strconv.Itoa(exitcode)
+	return vars
+}
+
+// RunHooks runs a set of hook commands in sequence. Hook failures are logged,
+// but do not stop subsequent hooks from running. Cancelling ctx stops the
+// running hook, and skips the rest.
+func RunHooks(
+	ctx context.Context,
+	i int,
+	b conf.Block,
+	kind string,
+	hooks []string,
+	vars map[string]string,
+	labels *Labels,
+	mod *moddwatch.Mod,
+	log termlog.TermLog,
+	notifiers []notify.Notifier,
+) {
+	if len(hooks) == 0 {
+		return
+	}
+	sh, err := blockShell(b, vars)
+	if err != nil {
+		log.Shout("Error running %s hook: %s", kind, err)
+		return
+	}
+	timeout, err := defaultTimeout(vars)
+	if err != nil {
+		log.Shout("Error running %s hook: %s", kind, err)
+		return
+	}
+
+	var modified []string
+	if mod != nil {
+		modified = mod.All()
+	}
+
+	vcmd := varcmd.VarCmd{Block: &b, Modified: modified, Vars: vars, Shell: sh}
+	for _, h := range hooks {
+		if ctx.Err() != nil {
+			return
+		}
+		cmd, err := vcmd.Render(h)
+		if err != nil {
+			log.Shout("Error running %s hook: %s", kind, err)
+			continue
+		}
+		ex, err := shell.NewExecutor(sh, cmd, b.InDir)
+		if err != nil {
+			log.Shout("Error running %s hook: %s", kind, err)
+			continue
+		}
+		ex.Timeout = timeout
+		ex.InProcess = true
+		ex.Notify = notifyFunc(i, b, cmd, notifiers)
+		err = RunProc(ctx, ex, commandStream(
+			log, i, b, kind, conf.CommandOptions{}, labels.Label(conf.CommandOptions{}, h), cmd,
+		))
+		if err != nil && ctx.Err() == nil {
+			if _, ok := err.(ProcError); !ok {
+				log.Shout("Error running %s hook: %s", kind, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package livereload implements a server for the livereload protocol, which
+// tells connected browsers to reload pages and stylesheets when files change.
+// Pages connect by including the script the server serves at /livereload.js,
+// or through a livereload browser extension.
+package livereload
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DefaultPort is the standard livereload port, used by browser extensions
+const DefaultPort = 35729
+
+// The version of the livereload protocol we speak
+const protocol = "http://livereload.com/protocols/official-7"
+
+// A command sent between the server and clients
+type command struct {
+	Command   string   `json:"command"`
+	Protocols []string `json:"protocols,omitempty"`
+	// Sent by the server in its hello
+	ServerName string `json:"serverName,omitempty"`
+	// Sent with reload commands
+	Path    string `json:"path,omitempty"`
+	LiveCSS bool   `json:"liveCSS,omitempty"`
+}
+
+// Server is a livereload server
+type Server struct {
+	// Connected clients that have completed the protocol handshake
+	clients map[*wsConn]bool
+	sync.Mutex
+}
+
+// New creates a Server
+func New() *Server {
+	return &Server{clients: map[*wsConn]bool{}}
+}
+
+// Handler returns the HTTP handler for the server. It serves the WebSocket
+// endpoint at "/livereload", and the client script at "/livereload.js".
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livereload", s.serveWebSocket)
+	mux.HandleFunc("/livereload.js", serveScript)
+	return mux
+}
+
+// Listen starts serving on addr, and returns the address we're listening on.
+func (s *Server) Listen(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, s.Handler())
+	return l.Addr(), nil
+}
+
+func serveScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, script)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer func() {
+		s.Lock()
+		delete(s.clients, c)
+		s.Unlock()
+		c.Close()
+	}()
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		var cmd command
+		if err := json.Unmarshal(msg, &cmd); err != nil {
+			return
+		}
+		// Clients also send "info" and "url" commands, which we don't need
+		if cmd.Command != "hello" {
+			continue
+		}
+		reply, _ := json.Marshal(command{
+			Command:    "hello",
+			Protocols:  []string{protocol},
+			ServerName: "modd",
+		})
+		if err := c.writeText(reply); err != nil {
+			return
+		}
+		s.Lock()
+		s.clients[c] = true
+		s.Unlock()
+	}
+}
+
+// Clients returns the number of connected clients
+func (s *Server) Clients() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.clients)
+}
+
+// Reload tells clients that the files at paths have changed. If they're all
+// stylesheets, clients reload them in place, otherwise clients reload the
+// page.
+func (s *Server) Reload(paths []string) {
+	cmds := []command{}
+	for _, p := range paths {
+		if !strings.EqualFold(path.Ext(p), ".css") {
+			cmds = []command{{Command: "reload", Path: p}}
+			break
+		}
+		cmds = append(cmds, command{Command: "reload", Path: p, LiveCSS: true})
+	}
+	s.Lock()
+	clients := make([]*wsConn, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.Unlock()
+	for _, cmd := range cmds {
+		msg, _ := json.Marshal(cmd)
+		for _, c := range clients {
+			if err := c.writeText(msg); err != nil {
+				// The client is cleaned up when its read fails
+				c.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package livereload
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455
+	if k := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key: %s", k)
+	}
+}
+
+// testClient is a minimal WebSocket client
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, url string) *testClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(conn, "GET /livereload HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected handshake response: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept key: %s", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return &testClient{conn: conn, r: r}
+}
+
+// send writes a masked frame
+func (c *testClient) send(t *testing.T, fin bool, opcode byte, payload []byte) {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recv reads an unmasked frame
+func (c *testClient) recv(t *testing.T) (byte, []byte) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	if hdr[1]&0x80 != 0 {
+		t.Fatal("server frame is masked")
+	}
+	n := int(hdr[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+func (c *testClient) recvCommand(t *testing.T) command {
+	op, payload := c.recv(t)
+	if op != opText {
+		t.Fatalf("expected text frame, got opcode %d", op)
+	}
+	var cmd command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func (c *testClient) hello(t *testing.T) {
+	msg := `{"command":"hello","protocols":["` + protocol + `"]}`
+	// Send the hello in two fragments, with a ping in between
+	c.send(t, false, opText, []byte(msg[:10]))
+	c.send(t, true, opPing, []byte("ping"))
+	c.send(t, true, opContinuation, []byte(msg[10:]))
+	if op, payload := c.recv(t); op != opPong || string(payload) != "ping" {
+		t.Fatalf("expected pong, got opcode %d %q", op, payload)
+	}
+	if cmd := c.recvCommand(t); cmd.Command != "hello" || cmd.Protocols[0] != protocol {
+		t.Fatalf("unexpected hello: %#v", cmd)
+	}
+}
+
+func waitClients(t *testing.T, s *Server, n int) {
+	for i := 0; s.Clients() != n; i++ {
+		if i > 100 {
+			t.Fatalf("expected %d clients, got %d", n, s.Clients())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := New()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	c := dial(t, ts.URL)
+	defer c.conn.Close()
+	c.hello(t)
+	waitClients(t, s, 1)
+
+	s.Reload([]string{"static/app.css", "static/print.css"})
+	for _, p := range []string{"static/app.css", "static/print.css"} {
+		if cmd := c.recvCommand(t); cmd.Command != "reload" || cmd.Path != p || !cmd.LiveCSS {
+			t.Errorf("unexpected reload: %#v", cmd)
+		}
+	}
+	// Anything other than CSS reloads the page once
+	s.Reload([]string{"static/app.css", "index.html", "app.js"})
+	if cmd := c.recvCommand(t); cmd.Path != "index.html" || cmd.LiveCSS {
+		t.Errorf("unexpected reload: %#v", cmd)
+	}
+
+	c.send(t, true, opClose, []byte{0x03, 0xe8})
+	if op, payload := c.recv(t); op != opClose || string(payload) != "\x03\xe8" {
+		t.Errorf("expected close, got opcode %d %q", op, payload)
+	}
+	waitClients(t, s, 0)
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	s := New()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/livereload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a plain request, got %s", resp.Status)
+	}
+
+	resp, err = http.Get(ts.URL + "/livereload.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/javascript" {
+		t.Errorf("unexpected response for script: %s", resp.Status)
+	}
+}
@@ -0,0 +1,53 @@
+package livereload
+
+// The client script. It connects to the server it was loaded from, reloads
+// stylesheets in place for CSS changes, and reloads the page otherwise. If the
+// connection drops, it keeps trying to reconnect.
+const script = `(function () {
+	var src = document.currentScript && document.currentScript.src;
+	var host = src ? new URL(src).host : location.hostname + ":35729";
+
+	function reloadCSS(path) {
+		var name = path.split("/").pop();
+		var links = Array.prototype.slice.call(
+			document.querySelectorAll('link[rel~="stylesheet"][href]')
+		);
+		if (links.length == 0) {
+			return false;
+		}
+		var matched = links.filter(function (l) {
+			return l.href.split("?")[0].split("/").pop() == name;
+		});
+		(matched.length ? matched : links).forEach(function (l) {
+			var url = new URL(l.href);
+			url.searchParams.set("livereload", Date.now());
+			l.href = url.toString();
+		});
+		return true;
+	}
+
+	function connect() {
+		var ws = new WebSocket("ws://" + host + "/livereload");
+		ws.onopen = function () {
+			ws.send(JSON.stringify({
+				command: "hello",
+				protocols: ["http://livereload.com/protocols/official-7"]
+			}));
+		};
+		ws.onmessage = function (e) {
+			var msg = JSON.parse(e.data);
+			if (msg.command != "reload") {
+				return;
+			}
+			if (msg.liveCSS && /\.css$/i.test(msg.path) && reloadCSS(msg.path)) {
+				return;
+			}
+			location.reload();
+		};
+		ws.onclose = function () {
+			setTimeout(connect, 1000);
+		};
+	}
+	connect();
+})();
+`
@@ -0,0 +1,287 @@
+// Package metrics collects metrics about modd's feedback loop, and exposes them
+// in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+)
+
+// The content type of the Prometheus text format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A family is a set of metrics with the same name, distinguished by their
+// label values
+type family struct {
+	name   string
+	help   string
+	typ    string // "counter" or "histogram"
+	labels []string
+	// The upper bounds of histogram buckets
+	buckets []float64
+	// Series keyed by their label values
+	series map[string]*series
+}
+
+// A series is a single counter or histogram
+type series struct {
+	labels []string
+	// The value of a counter
+	value float64
+	// The number of observations in each histogram bucket, not including
+	// those in lower buckets
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newFamily(name string, help string, typ string, buckets []float64, labels ...string) *family {
+	return &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+}
+
+// get returns the series with the given label values, creating it if needed
+func (f *family) get(values ...string) *series {
+	key := strings.Join(values, "\x00")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: values, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) inc(values ...string) {
+	f.get(values...).value++
+}
+
+func (f *family) observe(v float64, values ...string) {
+	s := f.get(values...)
+	for i, b := range f.buckets {
+		if v <= b {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelString renders a set of labels, with an optional extra label
+func (f *family) labelString(s *series, extra ...string) string {
+	parts := []string{}
+	for i, l := range f.labels {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, l, escapeLabel(s.labels[i])))
+	}
+	if len(extra) == 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[0], extra[1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (f *family) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, b := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(
+				w, "%s_bucket%s %d\n",
+				f.name, f.labelString(s, "le", formatFloat(b)), cumulative,
+			)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s), s.count)
+	}
+}
+
+// Metrics collects modd's metrics. It's a notify.StatusNotifier, from which
+// it counts prep failures and daemon restarts. Other metrics are reported by
+// modd directly.
+type Metrics struct {
+	prepDuration   *family
+	prepFailures   *family
+	daemonRestarts *family
+	batchFiles     *family
+	watchLatency   *family
+
+	// Daemons that have started, keyed by block and daemon name
+	daemons map[string]bool
+	sync.Mutex
+}
+
+// New creates a Metrics
+func New() *Metrics {
+	return &Metrics{
+		prepDuration: newFamily(
+			"modd_prep_duration_seconds",
+			"Time taken to run a block's prep commands.",
+			"histogram",
+			[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+			"block",
+		),
+		prepFailures: newFamily(
+			"modd_prep_failures_total",
+			"Number of prep commands that failed or timed out.",
+			"counter",
+			nil,
+			"block",
+		),
+		daemonRestarts: newFamily(
+			"modd_daemon_restarts_total",
+			"Number of times a daemon was restarted.",
+			"counter",
+			nil,
+			"block", "daemon",
+		),
+		batchFiles: newFamily(
+			"modd_batch_files",
+			"Number of files in each batch of changes.",
+			"histogram",
+			[]float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+		),
+		watchLatency: newFamily(
+			"modd_watch_latency_seconds",
+			"Time from the most recent file change in a batch to modd running the blocks it triggered.",
+			"histogram",
+			[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			"block",
+		),
+		daemons: map[string]bool{},
+	}
+}
+
+// ObservePreps records the time taken to run a block's preps
+func (m *Metrics) ObservePreps(block string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.prepDuration.observe(d.Seconds(), block)
+}
+
+// ObserveBatch records the number of files in a batch of changes
+func (m *Metrics) ObserveBatch(files int) {
+	m.Lock()
+	defer m.Unlock()
+	m.batchFiles.observe(float64(files))
+}
+
+// ObserveLatency records the time from the most recent file change in a batch
+// to modd running it, for a block that the batch triggered
+func (m *Metrics) ObserveLatency(block string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.watchLatency.observe(d.Seconds(), block)
+}
+
+// Push implements notify.Notifier
+func (m *Metrics) Push(title string, text string, icon string) {}
+
+// PushEvent implements notify.EventNotifier
+func (m *Metrics) PushEvent(e notify.Event) {
+	m.Lock()
+	defer m.Unlock()
+	switch e.Type {
+	case notify.Failure, notify.Timeout:
+		m.prepFailures.inc(e.Block)
+	case notify.DaemonStart:
+		key := e.Block + "\x00" + e.Name
+		if m.daemons[key] {
+			m.daemonRestarts.inc(e.Block, e.Name)
+		} else {
+			// Create the series, so that it's reported before the first
+			// restart
+			m.daemonRestarts.get(e.Block, e.Name)
+			m.daemons[key] = true
+		}
+	}
+}
+
+// AllEvents implements notify.StatusNotifier
+func (m *Metrics) AllEvents() {}
+
+// Write writes the metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	m.Lock()
+	buf := bytes.Buffer{}
+	for _, f := range []*family{
+		m.prepDuration, m.prepFailures, m.daemonRestarts, m.batchFiles, m.watchLatency,
+	} {
+		f.write(&buf)
+	}
+	m.Unlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile writes the metrics to a file, replacing it if it exists
+func (m *Metrics) WriteFile(path string) error {
+	buf := bytes.Buffer{}
+	m.Write(&buf)
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Handler returns an HTTP handler that serves the metrics
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		m.Write(w)
+	})
+}
+
+// Listen starts serving the metrics at /metrics on addr, and returns the
+// address we're listening on.
+func (m *Metrics) Listen(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	go http.Serve(l, mux)
+	return l.Addr(), nil
+}
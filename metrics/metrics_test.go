@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+)
+
+func testMetrics() *Metrics {
+	m := New()
+	m.ObservePreps("**/*.go", 300*time.Millisecond)
+	m.ObservePreps("**/*.go", 3*time.Second)
+	m.ObserveBatch(1)
+	m.ObserveBatch(7)
+	m.ObserveLatency("**/*.go", 150*time.Millisecond)
+	m.PushEvent(notify.Event{Type: notify.Failure, Block: "**/*.go"})
+	m.PushEvent(notify.Event{Type: notify.Timeout, Block: "**/*.go"})
+	for i := 0; i < 3; i++ {
+		m.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "**/*.go", Name: "web"})
+	}
+	m.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "**/*.go", Name: "worker"})
+	return m
+}
+
+func TestWrite(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := testMetrics().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, l := range []string{
+		"# TYPE modd_prep_duration_seconds histogram",
+		`modd_prep_duration_seconds_bucket{block="**/*.go",le="0.25"} 0`,
+		`modd_prep_duration_seconds_bucket{block="**/*.go",le="0.5"} 1`,
+		`modd_prep_duration_seconds_bucket{block="**/*.go",le="5"} 2`,
+		`modd_prep_duration_seconds_bucket{block="**/*.go",le="+Inf"} 2`,
+		`modd_prep_duration_seconds_sum{block="**/*.go"} 3.3`,
+		`modd_prep_duration_seconds_count{block="**/*.go"} 2`,
+		"# TYPE modd_prep_failures_total counter",
+		`modd_prep_failures_total{block="**/*.go"} 2`,
+		`modd_daemon_restarts_total{block="**/*.go",daemon="web"} 2`,
+		`modd_daemon_restarts_total{block="**/*.go",daemon="worker"} 0`,
+		`modd_batch_files_bucket{le="1"} 1`,
+		`modd_batch_files_bucket{le="5"} 1`,
+		`modd_batch_files_bucket{le="10"} 2`,
+		`modd_batch_files_sum 8`,
+		`modd_watch_latency_seconds_bucket{block="**/*.go",le="0.25"} 1`,
+	} {
+		if !strings.Contains(out, l+"\n") {
+			t.Errorf("expected %q in output:\n%s", l, out)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	m := New()
+	m.PushEvent(notify.Event{Type: notify.Failure, Block: "\"a\\b\"\nc"})
+	buf := bytes.Buffer{}
+	m.Write(&buf)
+	expected := `modd_prep_failures_total{block="\"a\\b\"\nc"} 1`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q in output:\n%s", expected, buf.String())
+	}
+}
+
+func TestServe(t *testing.T) {
+	m := testMetrics()
+	ts := httptest.NewServer(m.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != contentType {
+		t.Errorf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "modd_prep_failures_total") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := testMetrics().WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# HELP modd_prep_duration_seconds") {
+		t.Errorf("unexpected file contents:\n%s", data)
+	}
+}
@@ -1,17 +1,26 @@
 package modd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/livereload"
+	"github.com/cortesi/modd/metrics"
 	"github.com/cortesi/modd/notify"
 	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/modd/status"
+	"github.com/cortesi/modd/tui"
 	"github.com/cortesi/moddwatch"
 	"github.com/cortesi/termlog"
+	"golang.org/x/term"
 )
 
 // Version is the modd release version
@@ -19,8 +28,22 @@ const Version = "0.8"
 
 const lullTime = time.Millisecond * 100
 
+// The maximum number of changed files listed in the separator printed when
+// clearing the screen
+const maxSeparatorFiles = 5
+
 const shellVarName = "@shell"
 
+const prepTimeoutVarName = "@preptimeout"
+
+const notifyCmdVarName = "@notifycmd"
+
+const logDirVarName = "@logdir"
+
+const outputLimitVarName = "@outputlimit"
+
+const outputMatchVarName = "@outputmatch"
+
 // CommonExcludes is a list of commonly excluded files suitable for passing in
 // the excludes parameter to Watch - includes repo directories, temporary
 // files, and so forth.
@@ -58,6 +81,62 @@ type ModRunner struct {
 	ConfPath   string
 	ConfReload bool
 	Notifiers  []notify.Notifier
+
+	// Clear the terminal before running blocks in response to changes
+	Clear bool
+
+	// NotifyRecovery sends a notification when a block succeeds after a
+	// failure
+	NotifyRecovery bool
+	// NotifySuccess sends a notification whenever a block succeeds
+	NotifySuccess bool
+	// NotifyCmd is a notification command template. If empty, the @notifycmd
+	// variable from the config file is used.
+	NotifyCmd string
+	// NotifyInterval is the minimum interval between notifications from each
+	// notifier. Notifications are not limited if it is zero.
+	NotifyInterval time.Duration
+
+	// Notifiers, plus any notifiers specified in the config file
+	allNotifiers []notify.Notifier
+
+	// Prefix each line of command output with a label identifying the
+	// command, instead of showing a header when output switches between
+	// commands
+	Prefix bool
+
+	// Labels for the commands in the current config
+	labels *Labels
+	// Renders line prefixes for the current config
+	prefixer *prefixer
+
+	// Dashboard shows the status and output of blocks and daemons in place
+	// of the log. Log must also be set to the dashboard.
+	Dashboard *tui.Dashboard
+
+	// StatusServer tracks the status and output of blocks and daemons for the
+	// status page. It should also be one of the Notifiers.
+	StatusServer *status.Server
+
+	// LiveReload tells browsers to reload when blocks with reload directives
+	// run
+	LiveReload *livereload.Server
+
+	// Metrics collects metrics about prep runs, batches of changes and
+	// watcher latency. It should also be one of the Notifiers.
+	Metrics *metrics.Metrics
+	// MetricsFile is a path that metrics are written to when modd exits. It
+	// should be absolute, since blocks may change the working directory.
+	MetricsFile string
+
+	// The last failure for each block whose most recent run failed, keyed by
+	// block index
+	failures map[int]*ProcError
+
+	// Cancelled when modd is shutting down, to stop running commands
+	ctx context.Context
+	// Held while a block runs, so that shutting down can wait for it
+	running sync.Mutex
 }
 
 // NewModRunner constructs a new ModRunner
@@ -89,30 +168,207 @@ func (mr *ModRunner) ReadConfig() error {
 	if _, err := shell.GetShellName(newcnf.GetVariables()[shellVarName]); err != nil {
 		return err
 	}
+	for _, b := range newcnf.Blocks {
+		if _, err := blockShell(b, nil); err != nil {
+			return err
+		}
+		for _, p := range b.Preps {
+			if _, err := commandShell(p.CommandOptions, b, nil); err != nil {
+				return err
+			}
+		}
+		for _, d := range b.Daemons {
+			if _, err := commandShell(d.CommandOptions, b, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := defaultTimeout(newcnf.GetVariables()); err != nil {
+		return fmt.Errorf("Error reading config file %s: %s", mr.ConfPath, err)
+	}
+	if _, _, err := outputOptions(newcnf.GetVariables()); err != nil {
+		return fmt.Errorf("Error reading config file %s: %s", mr.ConfPath, err)
+	}
+	if mr.Dashboard != nil {
+		if _, err := dashboardBlocks(newcnf); err != nil {
+			return fmt.Errorf("Error reading config file %s: %s", mr.ConfPath, err)
+		}
+	}
 
 	newcnf.CommonExcludes(CommonExcludes)
 	mr.Config = newcnf
+	mr.labels = NewLabels(newcnf)
+	mr.prefixer = newPrefixer(mr.labels)
+	mr.failures = nil
+	mr.allNotifiers = nil
 	return nil
 }
 
+// notifiers returns all active notifiers
+func (mr *ModRunner) notifiers() []notify.Notifier {
+	if mr.allNotifiers == nil {
+		ns := append([]notify.Notifier{}, mr.Notifiers...)
+		vars := mr.Config.GetVariables()
+		tmpl := mr.NotifyCmd
+		if tmpl == "" {
+			tmpl = vars[notifyCmdVarName]
+		}
+		if tmpl != "" {
+			// The shell has already been validated in ReadConfig
+			sh, _ := shell.GetShellName(vars[shellVarName])
+			ns = append(ns, notify.NewCommandNotifier(sh, tmpl, mr.Log))
+		}
+		if mr.NotifyInterval > 0 {
+			for i, n := range ns {
+				// Status updates should never be delayed
+				if _, ok := n.(notify.StatusNotifier); !ok {
+					ns[i] = notify.NewLimiter(n, mr.NotifyInterval)
+				}
+			}
+		}
+		mr.allNotifiers = ns
+	}
+	return mr.allNotifiers
+}
+
 // PrepOnly runs all prep functions and exits
 func (mr *ModRunner) PrepOnly(initial bool) error {
-	for _, b := range mr.Config.Blocks {
-		err := RunPreps(b, mr.Config.GetVariables(), nil, mr.Log, mr.Notifiers, initial)
+	defer mr.writeMetrics()
+	var nonfatal error
+	for i, b := range mr.Config.Blocks {
+		err := mr.runPreps(i, b, nil, initial)
 		if err != nil {
+			if pe, ok := err.(ProcError); ok && pe.NonFatal {
+				if nonfatal == nil {
+					nonfatal = err
+				}
+				continue
+			}
 			return err
 		}
 	}
-	return nil
+	return nonfatal
 }
 
-func (mr *ModRunner) runBlock(b conf.Block, mod *moddwatch.Mod, dpen *DaemonPen) {
-	if b.InDir != "" {
-		currentDir, err := os.Getwd()
-		if err != nil {
-			mr.Log.Shout("Error getting current working directory: %s", err)
-			return
+// runPreps runs the prep commands for block i, followed by any hooks that
+// apply to the outcome.
+func (mr *ModRunner) runPreps(i int, b conf.Block, mod *moddwatch.Mod, initial bool) error {
+	if mr.failures == nil {
+		mr.failures = map[int]*ProcError{}
+	}
+	start := time.Now()
+	mr.notify(notify.Event{Type: notify.Start, Block: blockName(b), BlockIndex: i, Start: start})
+	ctx := mr.context()
+	err := RunPreps(
+		ctx, i, b, mr.Config.GetVariables(), mr.commandLabels(), mod, mr.log(), mr.notifiers(), initial,
+	)
+	if ctx.Err() != nil {
+		return err
+	}
+	if mr.Metrics != nil && len(b.Preps) > 0 {
+		mr.Metrics.ObservePreps(blockName(b), time.Since(start))
+	}
+	if pe, ok := err.(ProcError); ok {
+		mr.failures[i] = &pe
+		vars := hookVars(mr.Config.GetVariables(), b, &pe)
+		RunHooks(ctx, i, b, "onfail", b.OnFail, vars, mr.commandLabels(), mod, mr.log(), mr.notifiers())
+	} else if err == nil {
+		if prev, ok := mr.failures[i]; ok {
+			delete(mr.failures, i)
+			mr.notifyDone(notify.Recovery, "modd recovered", i, b, start)
+			vars := hookVars(mr.Config.GetVariables(), b, prev)
+			RunHooks(ctx, i, b, "onrecover", b.OnRecover, vars, mr.commandLabels(), mod, mr.log(), mr.notifiers())
+		} else {
+			mr.notifyDone(notify.Success, "modd success", i, b, start)
+		}
+		vars := hookVars(mr.Config.GetVariables(), b, nil)
+		RunHooks(ctx, i, b, "onsuccess", b.OnSuccess, vars, mr.commandLabels(), mod, mr.log(), mr.notifiers())
+	}
+	return err
+}
+
+// commandLabels returns the labels for the commands in the current config
+func (mr *ModRunner) commandLabels() *Labels {
+	if mr.labels == nil {
+		mr.labels = NewLabels(mr.Config)
+	}
+	return mr.labels
+}
+
+// context returns the context that stops running commands when modd shuts
+// down
+func (mr *ModRunner) context() context.Context {
+	if mr.ctx == nil {
+		return context.Background()
+	}
+	return mr.ctx
+}
+
+// log returns the log for command output, which prefixes each line if Prefix
+// is set, and records output for the status page
+func (mr *ModRunner) log() termlog.TermLog {
+	log := mr.Log
+	if mr.Prefix && mr.Dashboard == nil {
+		log = &prefixLog{TermLog: mr.Log, prefixer: mr.prefixer}
+	}
+	if mr.StatusServer != nil {
+		log = &recordLog{TermLog: log, recorder: mr.StatusServer}
+	}
+	return log
+}
+
+// wants returns true if the user has asked for notifications of type typ
+func (mr *ModRunner) wants(typ string) bool {
+	switch typ {
+	case notify.Failure, notify.Timeout, notify.Message:
+		return true
+	case notify.Recovery:
+		return mr.NotifyRecovery || mr.NotifySuccess
+	case notify.Success:
+		return mr.NotifySuccess
+	}
+	return false
+}
+
+// notify sends an event to all notifiers that want it. StatusNotifiers receive
+// all events.
+func (mr *ModRunner) notify(e notify.Event) {
+	for _, n := range mr.notifiers() {
+		if _, ok := n.(notify.StatusNotifier); ok || mr.wants(e.Type) {
+			notify.Send(n, e)
 		}
+	}
+}
+
+// notifyDone sends a notification for the successful completion of block i
+func (mr *ModRunner) notifyDone(typ string, title string, i int, b conf.Block, start time.Time) {
+	mr.notify(notify.Event{
+		Type:       typ,
+		Title:      title,
+		Text:       blockName(b) + ": " + typ,
+		Block:      blockName(b),
+		BlockIndex: i,
+		Start:      start,
+		End:        time.Now(),
+	})
+}
+
+// runBlock runs block i's prep commands, and then restarts its daemons. The
+// initial run skips +onchange preps.
+func (mr *ModRunner) runBlock(
+	i int, b conf.Block, mod *moddwatch.Mod, initial bool, dpen *DaemonPen,
+) {
+	mr.running.Lock()
+	defer mr.running.Unlock()
+	if mr.context().Err() != nil {
+		return
+	}
+	currentDir, err := os.Getwd()
+	if err != nil {
+		mr.Log.Shout("Error getting current working directory: %s", err)
+		return
+	}
+	if b.InDir != "" {
 		err = os.Chdir(b.InDir)
 		if err != nil {
 			mr.Log.Shout(
@@ -129,23 +385,92 @@ func (mr *ModRunner) runBlock(b conf.Block, mod *moddwatch.Mod, dpen *DaemonPen)
 			}
 		}()
 	}
-	err := RunPreps(
-		b,
-		mr.Config.GetVariables(),
-		mod, mr.Log,
-		mr.Notifiers,
-		mod == nil,
-	)
-	if err != nil {
-		if _, ok := err.(ProcError); !ok {
+	start := time.Now()
+	err = mr.runPreps(i, b, mod, initial)
+	if mr.context().Err() != nil {
+		return
+	} else if err != nil {
+		pe, ok := err.(ProcError)
+		if !ok {
 			mr.Log.Shout("Error running prep: %s", err)
+			return
+		} else if !pe.NonFatal {
+			return
 		}
-		return
 	}
 	dpen.Restart()
+	if !initial {
+		mr.reload(currentDir, b, mod, start)
+	}
 }
 
-func (mr *ModRunner) trigger(root string, mod *moddwatch.Mod, dworld *DaemonWorld) {
+// reload tells livereload clients to reload the files matching block b's
+// reload patterns that changed, or that were written since the block started
+// running at start. Nothing is sent if there are none.
+func (mr *ModRunner) reload(root string, b conf.Block, mod *moddwatch.Mod, start time.Time) {
+	if mr.LiveReload == nil || len(b.Reload) == 0 {
+		return
+	}
+	paths, err := reloadPaths(root, b, mod, start)
+	if err != nil {
+		mr.Log.Shout("Error filtering reload patterns: %s", err)
+		return
+	} else if len(paths) == 0 {
+		return
+	}
+	mr.Log.Notice("livereload: %s", strings.Join(paths, " "))
+	mr.LiveReload.Reload(paths)
+}
+
+// reloadPaths returns the files under root that match block b's reload
+// patterns, and that either changed in mod or were modified since the block
+// started running - usually because a prep command built them. Modification
+// times are compared to the second, since some filesystems don't record them
+// more precisely.
+func reloadPaths(root string, b conf.Block, mod *moddwatch.Mod, start time.Time) ([]string, error) {
+	found := map[string]bool{}
+	if mod != nil {
+		rmod, err := mod.Filter("", b.Reload, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range rmod.All() {
+			found[p] = true
+		}
+	}
+	files, err := moddwatch.List(root, b.Reload, nil)
+	if err != nil {
+		return nil, err
+	}
+	since := start.Truncate(time.Second)
+	for _, p := range files {
+		full := p
+		if !filepath.IsAbs(full) {
+			full = filepath.Join(root, p)
+		}
+		fi, err := os.Stat(full)
+		if err == nil && !fi.ModTime().Before(since) {
+			found[p] = true
+		}
+	}
+	paths := make([]string, 0, len(found))
+	for p := range found {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// trigger runs the blocks that match a batch of changes, the most recent of
+// which happened at changed, or all blocks if mod is nil. The changed time is
+// zero if it isn't known.
+func (mr *ModRunner) trigger(
+	root string, mod *moddwatch.Mod, changed time.Time, dworld *DaemonWorld,
+) {
+	// Filter the mod for each block first, so we know whether any block that
+	// is about to run wants the screen cleared.
+	lmods := make([]*moddwatch.Mod, len(mr.Config.Blocks))
+	clear := false
 	for i, b := range mr.Config.Blocks {
 		lmod := mod
 		if lmod != nil {
@@ -159,23 +484,162 @@ func (mr *ModRunner) trigger(root string, mod *moddwatch.Mod, dworld *DaemonWorl
 				continue
 			}
 		}
-		mr.runBlock(b, lmod, dworld.DaemonPens[i])
+		lmods[i] = lmod
+		clear = clear || mr.Clear || b.Clear
+	}
+	if clear && mod != nil && mr.Dashboard == nil {
+		mr.clearScreen(mod)
+	}
+	if mr.Metrics != nil && mod != nil {
+		mr.Metrics.ObserveBatch(len(mod.All()))
+		// The latency is taken once for the whole batch, so that it doesn't
+		// include the time taken to run earlier blocks
+		if !changed.IsZero() {
+			latency := time.Since(changed)
+			if latency < 0 {
+				latency = 0
+			}
+			for i, b := range mr.Config.Blocks {
+				if lmods[i] != nil {
+					mr.Metrics.ObserveLatency(blockName(b), latency)
+				}
+			}
+		}
 	}
+	for i, b := range mr.Config.Blocks {
+		if mod == nil || lmods[i] != nil {
+			mr.runBlock(i, b, lmods[i], mod == nil, dworld.DaemonPens[i])
+		}
+	}
+}
+
+// A batch is a set of changes from the watcher, with the time of the most
+// recent change
+type batch struct {
+	mod     *moddwatch.Mod
+	changed time.Time
+}
+
+// lastModified returns the most recent modification time of the files in mod
+// that still exist, with paths relative to root. It returns the zero time if
+// there are none - if all the files were deleted, for instance.
+func lastModified(root string, mod *moddwatch.Mod) time.Time {
+	var last time.Time
+	for _, p := range mod.All() {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		fi, err := os.Stat(p)
+		if err == nil && fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+	return last
+}
+
+// stampBatches records the time of the most recent change in each batch of
+// changes as soon as the watcher delivers it, before the files can change
+// again while modd is busy. It stops when ctx is done.
+func stampBatches(
+	ctx context.Context, root string, modchan <-chan *moddwatch.Mod,
+) <-chan batch {
+	batches := make(chan batch, cap(modchan))
+	go func() {
+		for {
+			select {
+			case mod := <-modchan:
+				b := batch{mod: mod}
+				if mod != nil {
+					b.changed = lastModified(root, mod)
+				}
+				select {
+				case batches <- b:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return batches
+}
+
+// writeMetrics writes metrics to MetricsFile, if it's set
+func (mr *ModRunner) writeMetrics() {
+	if mr.Metrics == nil || mr.MetricsFile == "" {
+		return
+	}
+	if err := mr.Metrics.WriteFile(mr.MetricsFile); err != nil {
+		mr.Log.Shout("Error writing metrics: %s", err)
+	}
+}
+
+// clearScreen clears the terminal, if we're connected to one, and prints a
+// separator listing the changed files.
+func (mr *ModRunner) clearScreen(mod *moddwatch.Mod) {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print("\033[H\033[2J\033[3J")
+	}
+	changed := mod.All()
+	summary := strings.Join(changed, " ")
+	if len(changed) > maxSeparatorFiles {
+		summary = fmt.Sprintf(
+			"%s (and %d more)",
+			strings.Join(changed[:maxSeparatorFiles], " "),
+			len(changed)-maxSeparatorFiles,
+		)
+	}
+	mr.Log.Notice("━━━━━━━━ %d changed: %s", len(changed), summary)
 }
 
 // Gives control of chan to caller
 func (mr *ModRunner) runOnChan(modchan chan *moddwatch.Mod, readyCallback func()) error {
-	dworld, err := NewDaemonWorld(mr.Config, mr.Log)
+	var actions <-chan tui.Action
+	var quit <-chan struct{}
+	if mr.Dashboard != nil {
+		blocks, err := dashboardBlocks(mr.Config)
+		if err != nil {
+			return err
+		}
+		mr.Dashboard.Configure(blocks)
+		actions = mr.Dashboard.Actions()
+		quit = mr.Dashboard.Quit()
+	}
+	if mr.StatusServer != nil {
+		mr.StatusServer.Configure(statusBlocks(mr.Config))
+	}
+	dworld, err := NewDaemonWorld(mr.Config, mr.commandLabels(), mr.log(), mr.notifiers())
 	if err != nil {
 		return err
 	}
 	defer dworld.Shutdown(os.Kill)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mr.ctx = ctx
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, os.Kill)
 	defer signal.Reset(os.Interrupt, os.Kill)
 	go func() {
-		dworld.Shutdown(<-c)
+		// Quitting from the dashboard is handled here rather than in the main
+		// loop, so that it works while a block is running
+		sig := os.Signal(os.Interrupt)
+		select {
+		case sig = <-c:
+		case <-quit:
+		case <-ctx.Done():
+			return
+		}
+		// Stop any running commands, and wait for their block to finish
+		cancel()
+		mr.running.Lock()
+		dworld.Shutdown(sig)
+		if mr.Dashboard != nil {
+			mr.Dashboard.Close()
+		}
+		mr.writeMetrics()
 		os.Exit(0)
 	}()
 
@@ -197,30 +661,97 @@ func (mr *ModRunner) runOnChan(modchan chan *moddwatch.Mod, readyCallback func()
 	}
 	defer watcher.Stop()
 
-	mr.trigger(currentDir, nil, dworld)
+	mr.trigger(currentDir, nil, time.Time{}, dworld)
 	go readyCallback()
-	for mod := range modchan {
-		if mod == nil {
-			break
+	batches := stampBatches(ctx, currentDir, modchan)
+	for {
+		select {
+		case a := <-actions:
+			mr.runAction(a, dworld)
+		case b := <-batches:
+			mod := b.mod
+			if mod == nil {
+				return nil
+			}
+			if mr.ConfReload && mod.Has(mr.ConfPath) {
+				mr.Log.Notice("Reloading config %s", mr.ConfPath)
+				err := mr.ReadConfig()
+				if err != nil {
+					mr.Log.Warn("%s", err)
+					continue
+				} else {
+					return nil
+				}
+			}
+			mr.Log.SayAs("debug", "Delta: \n%s", mod.String())
+			mr.trigger(currentDir, mod, b.changed, dworld)
 		}
-		if mr.ConfReload && mod.Has(mr.ConfPath) {
-			mr.Log.Notice("Reloading config %s", mr.ConfPath)
-			err := mr.ReadConfig()
-			if err != nil {
-				mr.Log.Warn("%s", err)
-				continue
+	}
+}
+
+// runAction runs an action requested from the dashboard
+func (mr *ModRunner) runAction(a tui.Action, dworld *DaemonWorld) {
+	for i, b := range mr.Config.Blocks {
+		if a.Block >= 0 && a.Block != i {
+			continue
+		}
+		switch a.Type {
+		case tui.Trigger:
+			mr.Log.Notice("━━━━━━━━ triggered: %s", blockName(b))
+			mr.runBlock(i, b, nil, false, dworld.DaemonPens[i])
+		case tui.Restart:
+			if a.Daemon < 0 {
+				dworld.DaemonPens[i].Restart()
 			} else {
-				return nil
+				dworld.DaemonPens[i].RestartDaemon(a.Daemon)
 			}
 		}
-		mr.Log.SayAs("debug", "Delta: \n%s", mod.String())
-		mr.trigger(currentDir, mod, dworld)
 	}
-	return nil
+}
+
+// dashboardBlocks describes the blocks and daemons in a config for the
+// dashboard
+func dashboardBlocks(cnf *conf.Config) ([]tui.Block, error) {
+	labels := NewLabels(cnf)
+	blocks := make([]tui.Block, len(cnf.Blocks))
+	for i, b := range cnf.Blocks {
+		blocks[i].Name = blockName(b)
+		for _, d := range b.Daemons {
+			if d.Stdin {
+				return nil, fmt.Errorf("+stdin can't be used with the dashboard")
+			}
+			blocks[i].Daemons = append(blocks[i].Daemons, labels.Label(d.CommandOptions, d.Command))
+		}
+	}
+	return blocks, nil
+}
+
+// statusBlocks describes the blocks, preps and daemons in a config for the
+// status page
+func statusBlocks(cnf *conf.Config) []status.Block {
+	labels := NewLabels(cnf)
+	blocks := make([]status.Block, len(cnf.Blocks))
+	for i, b := range cnf.Blocks {
+		blocks[i].Name = blockName(b)
+		for _, p := range b.Preps {
+			blocks[i].Preps = append(blocks[i].Preps, status.Command{
+				Name:    labels.Label(p.CommandOptions, p.Command),
+				Command: p.Command,
+			})
+		}
+		for _, d := range b.Daemons {
+			blocks[i].Daemons = append(blocks[i].Daemons, status.Command{
+				Name:    labels.Label(d.CommandOptions, d.Command),
+				Command: d.Command,
+			})
+		}
+	}
+	return blocks
 }
 
 // Run is the top-level runner for modd
 func (mr *ModRunner) Run() error {
+	defer mr.writeMetrics()
 	for {
 		modchan := make(chan *moddwatch.Mod, 1024)
 		err := mr.runOnChan(modchan, func() {})
@@ -1,6 +1,7 @@
 package modd
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/notify"
 	"github.com/cortesi/modd/utils"
 	"github.com/cortesi/moddwatch"
 	"github.com/cortesi/termlog"
@@ -224,3 +226,164 @@ func TestWatch(t *testing.T) {
 		},
 	)
 }
+
+type testNotifier struct {
+	titles []string
+}
+
+func (n *testNotifier) Push(title string, text string, icon string) {
+	n.titles = append(n.titles, title)
+}
+
+func TestHooks(t *testing.T) {
+	defer utils.WithTempDir(t)()
+
+	confTxt := `
+		@shell = bash
+
+		{
+			prep: test ! -e fail || (echo failing >&2; exit 3)
+			onfail: echo ":fail:" @exitcode @output
+			onrecover: echo ":recover:" @failedcmd
+			onsuccess: echo ":success:" ok
+		}
+	`
+	cnf, err := conf.Parse("test", confTxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt := termlog.NewLogTest()
+	tn := &testNotifier{}
+	mr := ModRunner{
+		Log:            lt.Log,
+		Config:         cnf,
+		Notifiers:      []notify.Notifier{tn},
+		NotifyRecovery: true,
+	}
+
+	mr.PrepOnly(true)
+	touch("fail")
+	mr.PrepOnly(true)
+	mr.PrepOnly(true)
+	os.Remove("fail")
+	mr.PrepOnly(true)
+
+	expected := []string{
+		":success: ok",
+		":fail: 3 failing",
+		":fail: 3 failing",
+		":recover: test ! -e fail || (echo failing >&2; exit 3)",
+		":success: ok",
+	}
+	ret := events(lt.String())
+	if !reflect.DeepEqual(ret, expected) {
+		t.Errorf("Expected\n%#v\nGot\n%#v", expected, ret)
+	}
+	titles := []string{"modd error", "modd error", "modd recovered"}
+	if !reflect.DeepEqual(tn.titles, titles) {
+		t.Errorf("Expected\n%#v\nGot\n%#v", titles, tn.titles)
+	}
+}
+
+func TestNoErr(t *testing.T) {
+	confTxt := `
+		@shell = bash
+
+		{
+			prep +noerr: exit 2
+			prep: echo ":after:" ok
+			onfail: echo ":fail:" @exitcode
+		}
+	`
+	cnf, err := conf.Parse("test", confTxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt := termlog.NewLogTest()
+	mr := ModRunner{
+		Log:    lt.Log,
+		Config: cnf,
+	}
+
+	err = mr.PrepOnly(true)
+	if pe, ok := err.(ProcError); !ok || !pe.NonFatal {
+		t.Errorf("Expected non-fatal error, got %#v", err)
+	}
+	expected := []string{":after: ok", ":fail: 2"}
+	ret := events(lt.String())
+	if !reflect.DeepEqual(ret, expected) {
+		t.Errorf("Expected\n%#v\nGot\n%#v", expected, ret)
+	}
+}
+
+func TestReloadPaths(t *testing.T) {
+	defer utils.WithTempDir(t)()
+	touch("static/css/old.css")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes("static/css/old.css", old, old); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	touch("static/css/built.css")
+
+	b := conf.Block{Reload: []string{"static/**/*.css", "*.html"}}
+	tests := []struct {
+		mod      *moddwatch.Mod
+		expected []string
+	}{
+		{nil, []string{"static/css/built.css"}},
+		{&moddwatch.Mod{Changed: []string{"app.scss"}}, []string{"static/css/built.css"}},
+		{
+			&moddwatch.Mod{Changed: []string{"static/css/app.css", "index.html", "app.go"}},
+			[]string{"index.html", "static/css/app.css", "static/css/built.css"},
+		},
+	}
+	for i, tt := range tests {
+		paths, err := reloadPaths(".", b, tt.mod, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(paths, tt.expected) {
+			t.Errorf("%d: expected %q, got %q", i, tt.expected, paths)
+		}
+	}
+
+	// Nothing matches if no reload file changed or was built
+	paths, err := reloadPaths(".", b, &moddwatch.Mod{Changed: []string{"app.go"}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("expected no paths, got %q", paths)
+	}
+}
+
+func TestStampBatches(t *testing.T) {
+	dir := t.TempDir()
+	touch(filepath.Join(dir, "a.go"))
+	changed := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(dir, "a.go"), changed, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	modchan := make(chan *moddwatch.Mod, 2)
+	batches := stampBatches(ctx, dir, modchan)
+
+	mod := &moddwatch.Mod{Changed: []string{"a.go"}}
+	modchan <- mod
+	b := <-batches
+	if b.mod != mod {
+		t.Errorf("unexpected mod: %v", b.mod)
+	}
+	if !b.changed.Equal(changed) {
+		t.Errorf("expected change time %s, got %s", changed, b.changed)
+	}
+
+	// Deleted files have no change time
+	modchan <- &moddwatch.Mod{Deleted: []string{"b.go"}}
+	if b := <-batches; !b.changed.IsZero() {
+		t.Errorf("expected no change time, got %s", b.changed)
+	}
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/modd/varcmd"
+	"github.com/cortesi/termlog"
+)
+
+// CommandNotifier runs a command for each notification. The command is a
+// template in which the @title, @body and @status variables are replaced with
+// the details of the notification.
+type CommandNotifier struct {
+	Shell    string
+	Template string
+	Log      termlog.TermLog
+	// Timeout is the maximum time the command may run before it's terminated
+	Timeout time.Duration
+	// Identical notifications within the Dedup window are suppressed
+	Dedup time.Duration
+
+	last     string
+	lastTime time.Time
+	sync.Mutex
+}
+
+// NewCommandNotifier creates a CommandNotifier with sensible defaults
+func NewCommandNotifier(shell string, template string, log termlog.TermLog) *CommandNotifier {
+	return &CommandNotifier{
+		Shell:    shell,
+		Template: template,
+		Log:      log,
+		Timeout:  10 * time.Second,
+		Dedup:    10 * time.Second,
+	}
+}
+
+// Push implements Notifier
+func (c *CommandNotifier) Push(title string, text string, iconPath string) {
+	c.PushEvent(Event{Title: title, Text: text})
+}
+
+// PushEvent implements EventNotifier. The command is run in the background.
+func (c *CommandNotifier) PushEvent(e Event) {
+	go c.Run(e)
+}
+
+// Run synchronously runs the notification command for an event
+func (c *CommandNotifier) Run(e Event) {
+	c.Lock()
+	defer c.Unlock()
+
+	vc := varcmd.VarCmd{
+		Vars: map[string]string{
+			"@title":  varcmd.QuoteFor(c.Shell, e.Title),
+			"@body":   varcmd.QuoteFor(c.Shell, e.Text),
+			"@status": varcmd.QuoteFor(c.Shell, e.Type),
+		},
+		Shell: c.Shell,
+	}
+	cmd, err := vc.Render(c.Template)
+	if err != nil {
+		c.Log.Shout("Error rendering notification command: %s", err)
+		return
+	}
+	if cmd == c.last && time.Since(c.lastTime) < c.Dedup {
+		return
+	}
+	c.last = cmd
+	c.lastTime = time.Now()
+
+	ex, err := shell.NewExecutor(c.Shell, cmd, "")
+	if err != nil {
+		c.Log.Shout("Error running notification command: %s", err)
+		return
+	}
+	ex.Timeout = c.Timeout
+	log := c.Log.Stream("notify: " + c.Template)
+	err, estate := ex.Run(log, false)
+	if err != nil {
+		log.Shout("%s", err)
+	} else if estate.TimedOut {
+		log.Shout("timed out after %s", c.Timeout)
+	} else if estate.Error != nil {
+		log.Shout("%s", estate.Error)
+	}
+}
@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/termlog"
+)
+
+func TestCommandNotifier(t *testing.T) {
+	if _, err := shell.CheckShell("bash"); err != nil {
+		t.Skipf("skipping - %s", err)
+	}
+	lt := termlog.NewLogTest()
+	c := NewCommandNotifier("bash", "echo :@status: @title @body", lt.Log)
+
+	c.Run(Event{Type: Failure, Title: "modd error", Text: "it's broken"})
+	c.Run(Event{Type: Failure, Title: "modd error", Text: "it's broken"})
+	c.Run(Event{Type: Recovery, Title: "modd recovered", Text: "fixed"})
+
+	out := lt.String()
+	if n := strings.Count(out, ":failure: modd error it's broken"); n != 1 {
+		t.Errorf("Expected one failure notification, got %d:\n%s", n, out)
+	}
+	if !strings.Contains(out, ":recovery: modd recovered fixed") {
+		t.Errorf("Expected recovery notification:\n%s", out)
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limiter wraps a Notifier to enforce a minimum interval between
+// notifications. Notifications that arrive within the interval are held back,
+// and when the interval expires only the most recent is sent, with a summary of
+// the notifications it replaces. Held notifications that are identical to the
+// last one sent are coalesced, and not sent again.
+type Limiter struct {
+	Notifier Notifier
+	Interval time.Duration
+
+	last       time.Time
+	lastKey    string
+	pending    *Event
+	changed    bool
+	suppressed int
+	timer      *time.Timer
+	sync.Mutex
+}
+
+// NewLimiter wraps a notifier in a Limiter
+func NewLimiter(n Notifier, interval time.Duration) *Limiter {
+	return &Limiter{Notifier: n, Interval: interval}
+}
+
+func eventKey(e Event) string {
+	return e.Title + "\x00" + e.Text
+}
+
+// Push implements Notifier
+func (l *Limiter) Push(title string, text string, iconPath string) {
+	l.PushEvent(Event{Title: title, Text: text})
+}
+
+// PushEvent implements EventNotifier
+func (l *Limiter) PushEvent(e Event) {
+	l.Lock()
+	defer l.Unlock()
+	elapsed := time.Since(l.last)
+	if l.timer == nil && elapsed >= l.Interval {
+		l.deliver(e)
+		return
+	}
+	if l.pending != nil {
+		l.suppressed++
+	}
+	l.pending = &e
+	if eventKey(e) != l.lastKey {
+		l.changed = true
+	}
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.Interval-elapsed, l.flush)
+	}
+}
+
+func (l *Limiter) flush() {
+	l.Lock()
+	defer l.Unlock()
+	e, changed, suppressed := l.pending, l.changed, l.suppressed
+	l.timer = nil
+	l.pending = nil
+	l.changed = false
+	l.suppressed = 0
+	if e == nil || !changed {
+		return
+	}
+	if suppressed == 1 {
+		e.Text += "\n(1 earlier notification suppressed)"
+	} else if suppressed > 1 {
+		e.Text += fmt.Sprintf("\n(%d earlier notifications suppressed)", suppressed)
+	}
+	l.deliver(*e)
+}
+
+func (l *Limiter) deliver(e Event) {
+	l.last = time.Now()
+	l.lastKey = eventKey(e)
+	Send(l.Notifier, e)
+}
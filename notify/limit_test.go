@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	texts []string
+	sync.Mutex
+}
+
+func (r *recorder) Push(title string, text string, iconPath string) {
+	r.Lock()
+	defer r.Unlock()
+	r.texts = append(r.texts, text)
+}
+
+func (r *recorder) get() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string{}, r.texts...)
+}
+
+func TestLimiter(t *testing.T) {
+	interval := 100 * time.Millisecond
+	r := &recorder{}
+	l := NewLimiter(r, interval)
+
+	// Identical notifications within the interval are coalesced
+	l.Push("modd error", "one", "")
+	l.Push("modd error", "one", "")
+	l.Push("modd error", "one", "")
+	time.Sleep(2 * interval)
+	expected := []string{"one"}
+	if got := r.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%#v\ngot\n%#v", expected, got)
+	}
+
+	// Distinct notifications are summarized
+	l.Push("modd error", "one", "")
+	l.Push("modd error", "two", "")
+	l.Push("modd error", "three", "")
+	time.Sleep(2 * interval)
+	expected = []string{"one", "one", "three\n(1 earlier notification suppressed)"}
+	if got := r.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%#v\ngot\n%#v", expected, got)
+	}
+}
@@ -3,6 +3,7 @@ package notify
 import (
 	"fmt"
 	"os/exec"
+	"time"
 )
 
 const prog = "modd"
@@ -15,11 +16,75 @@ func hasExecutable(name string) bool {
 	return true
 }
 
+// Event types
+const (
+	Start    = "start"
+	Failure  = "failure"
+	Timeout  = "timeout"
+	Recovery = "recovery"
+	Success  = "success"
+	// Message is a notification sent explicitly by a command
+	Message = "message"
+	// DaemonStart and DaemonExit are sent when a daemon process starts and
+	// exits. They're only sent to StatusNotifiers.
+	DaemonStart = "daemon-start"
+	DaemonExit  = "daemon-exit"
+)
+
 // A Notifier notifies
 type Notifier interface {
 	Push(title string, content string, icon string)
 }
 
+// An Event describes the occurrence that triggered a notification
+type Event struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Block string `json:"block,omitempty"`
+	// BlockIndex is the index of the block in the config. Block names aren't
+	// unique, so this identifies the block for StatusNotifiers.
+	BlockIndex int       `json:"-"`
+	Command    string    `json:"command,omitempty"`
+	Name       string    `json:"name,omitempty"` // Label identifying the command
+	ExitCode   int       `json:"exitcode"`
+	Signal     string    `json:"signal,omitempty"`
+	UserTime   float64   `json:"usertime,omitempty"` // User CPU time in seconds
+	SysTime    float64   `json:"systime,omitempty"`  // System CPU time in seconds
+	MaxRSS     int64     `json:"maxrss,omitempty"`   // Max resident set size in bytes
+	Output     string    `json:"output,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Delay      float64   `json:"delay,omitempty"` // Seconds until a daemon restarts
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// An EventNotifier is a Notifier that can receive structured events
+type EventNotifier interface {
+	Notifier
+	PushEvent(e Event)
+}
+
+// A StatusNotifier is an EventNotifier that tracks modd's overall status.
+// Unlike other notifiers, StatusNotifiers receive every event - including a
+// Start event at the beginning of each block run, and every success - and
+// they are never rate limited.
+type StatusNotifier interface {
+	EventNotifier
+	// AllEvents marks the notifier as a StatusNotifier. It does nothing.
+	AllEvents()
+}
+
+// Send delivers an event to a notifier. EventNotifiers receive the complete
+// event, and other notifiers receive its title and text.
+func Send(n Notifier, e Event) {
+	if en, ok := n.(EventNotifier); ok {
+		en.PushEvent(e)
+		return
+	}
+	n.Push(e.Title, e.Text, "")
+}
+
 // BeepNotifier just emits a beep on the terminal
 type BeepNotifier struct{}
 
@@ -34,21 +99,37 @@ type GrowlNotifier struct {
 
 // Push implements Notifier
 func (GrowlNotifier) Push(title string, text string, iconPath string) {
-	cmd := exec.Command(
-		"growlnotify", "-n", prog, "-d", prog, "-m", text, prog,
-	)
+	args := []string{"-n", prog, "-d", prog, "-m", text}
+	if iconPath != "" {
+		args = append(args, "--image", iconPath)
+	}
+	cmd := exec.Command("growlnotify", append(args, title)...)
 	go cmd.Run()
 }
 
 // LibnotifyNotifier is a notifier for lib-notify
 type LibnotifyNotifier struct {
+	// Urgency is the notification urgency level - one of "low", "normal" or
+	// "critical". If empty, the notification daemon's default is used.
+	Urgency string
+	// Icon is the path or name of the icon used when Push is called with an
+	// empty icon path.
+	Icon string
 }
 
 // Push implements Notifier
-func (LibnotifyNotifier) Push(title string, text string, iconPath string) {
-	cmd := exec.Command(
-		"notify-send", prog, text,
-	)
+func (n LibnotifyNotifier) Push(title string, text string, iconPath string) {
+	args := []string{}
+	if n.Urgency != "" {
+		args = append(args, "-u", n.Urgency)
+	}
+	if iconPath == "" {
+		iconPath = n.Icon
+	}
+	if iconPath != "" {
+		args = append(args, "-i", iconPath)
+	}
+	cmd := exec.Command("notify-send", append(args, title, text)...)
 	go cmd.Run()
 }
 
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Matches terminal escape sequences in command output
+var escapeRegexp = regexp.MustCompile(
+	`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`,
+)
+
+// StripEscapes removes terminal escape sequences from command output
+func StripEscapes(s string) string {
+	return escapeRegexp.ReplaceAllString(s, "")
+}
+
+// ExitMessage describes how the command in an event exited
+func (e Event) ExitMessage() string {
+	if e.Signal != "" {
+		return "signal: " + e.Signal
+	}
+	return fmt.Sprintf("exit status %d", e.ExitCode)
+}
+
+// Summary returns a short description of modd's overall status, given the
+// status of each block: "running", "ok", "failed" or "timed out".
+func Summary(statuses []string) string {
+	failed, running := 0, false
+	for _, s := range statuses {
+		switch s {
+		case "failed", "timed out":
+			failed++
+		case "running":
+			running = true
+		}
+	}
+	if failed > 0 {
+		return fmt.Sprintf("%d failed", failed)
+	} else if running {
+		return "running"
+	}
+	return "ok"
+}
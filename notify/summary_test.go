@@ -0,0 +1,36 @@
+package notify
+
+import "testing"
+
+func TestStripEscapes(t *testing.T) {
+	s := StripEscapes("\x1b[1;31mred\x1b[0m \x1b]0;title\x07text")
+	if s != "red text" {
+		t.Errorf("unexpected result: %q", s)
+	}
+}
+
+func TestExitMessage(t *testing.T) {
+	if m := (Event{ExitCode: 2}).ExitMessage(); m != "exit status 2" {
+		t.Errorf("unexpected message: %q", m)
+	}
+	if m := (Event{ExitCode: -1, Signal: "killed"}).ExitMessage(); m != "signal: killed" {
+		t.Errorf("unexpected message: %q", m)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		expected string
+	}{
+		{nil, "ok"},
+		{[]string{"ok", ""}, "ok"},
+		{[]string{"ok", "running"}, "running"},
+		{[]string{"failed", "running", "timed out"}, "2 failed"},
+	}
+	for _, tt := range tests {
+		if s := Summary(tt.statuses); s != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.statuses, tt.expected, s)
+		}
+	}
+}
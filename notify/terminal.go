@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TerminalNotifier shows modd's status in the terminal window title, and
+// sends notifications using terminal escape sequences where the terminal
+// supports them. When running inside tmux, the tmux window name is also
+// updated.
+type TerminalNotifier struct {
+	Out io.Writer
+	// OSC9 enables iTerm2-style OSC 9 notifications
+	OSC9 bool
+	// OSC777 enables urxvt and VTE-style OSC 777 notifications
+	OSC777 bool
+	// Tmux is set when running inside tmux
+	Tmux bool
+
+	running string
+	failed  map[string]bool
+	sync.Mutex
+}
+
+// NewTerminalNotifier creates a TerminalNotifier writing to stdout, detecting
+// the terminal's capabilities from the environment.
+func NewTerminalNotifier() *TerminalNotifier {
+	tp := os.Getenv("TERM_PROGRAM")
+	return &TerminalNotifier{
+		Out: os.Stdout,
+		OSC9: tp == "iTerm.app" || tp == "WezTerm" ||
+			os.Getenv("WT_SESSION") != "" || os.Getenv("ConEmuANSI") == "ON",
+		OSC777: os.Getenv("VTE_VERSION") != "" ||
+			strings.HasPrefix(os.Getenv("TERM"), "rxvt"),
+		Tmux:   os.Getenv("TMUX") != "",
+		failed: map[string]bool{},
+	}
+}
+
+// Push implements Notifier
+func (t *TerminalNotifier) Push(title string, text string, iconPath string) {
+	t.Lock()
+	defer t.Unlock()
+	t.notify(title, text)
+}
+
+// PushEvent implements EventNotifier
+func (t *TerminalNotifier) PushEvent(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	switch e.Type {
+	case Start:
+		t.running = e.Block
+	case Failure, Timeout:
+		t.running = ""
+		t.failed[e.Block] = true
+		t.notify(e.Title, e.Block)
+	case Recovery:
+		t.running = ""
+		delete(t.failed, e.Block)
+		t.notify(e.Title, e.Block)
+	case Success:
+		t.running = ""
+		delete(t.failed, e.Block)
+	case Message:
+		t.notify(e.Title, e.Text)
+	case DaemonStart, DaemonExit:
+		return
+	}
+	status := "modd: " + t.status()
+	fmt.Fprintf(t.Out, "\033]0;%s\007", sanitize(status))
+	if t.Tmux {
+		go exec.Command("tmux", "rename-window", "-t", os.Getenv("TMUX_PANE"), status).Run()
+	}
+}
+
+// AllEvents implements StatusNotifier
+func (t *TerminalNotifier) AllEvents() {}
+
+// Status returns a short description of the current status
+func (t *TerminalNotifier) Status() string {
+	t.Lock()
+	defer t.Unlock()
+	return t.status()
+}
+
+func (t *TerminalNotifier) status() string {
+	if t.running != "" {
+		return "running " + t.running
+	}
+	if len(t.failed) > 0 {
+		blocks := []string{}
+		for b := range t.failed {
+			blocks = append(blocks, b)
+		}
+		sort.Strings(blocks)
+		return "failed " + strings.Join(blocks, ", ")
+	}
+	return "ok"
+}
+
+// notify emits a notification escape sequence, if the terminal supports one
+func (t *TerminalNotifier) notify(title string, text string) {
+	var seq string
+	if t.OSC9 {
+		seq = fmt.Sprintf("\033]9;%s: %s\007", sanitize(title), sanitize(text))
+	} else if t.OSC777 {
+		// Semicolons delimit fields in OSC 777
+		title = strings.Replace(sanitize(title), ";", ",", -1)
+		text = strings.Replace(sanitize(text), ";", ",", -1)
+		seq = fmt.Sprintf("\033]777;notify;%s;%s\007", title, text)
+	} else {
+		return
+	}
+	if t.Tmux {
+		// Wrap the sequence so that tmux passes it through to the terminal
+		seq = "\033Ptmux;" + strings.Replace(seq, "\033", "\033\033", -1) + "\033\\"
+	}
+	fmt.Fprint(t.Out, seq)
+}
+
+// sanitize removes characters that would terminate an escape sequence, and
+// condenses whitespace.
+func sanitize(s string) string {
+	s = strings.Map(
+		func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return ' '
+			}
+			return r
+		},
+		s,
+	)
+	return strings.Join(strings.Fields(s), " ")
+}
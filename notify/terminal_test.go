@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTerminalNotifier(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tn := &TerminalNotifier{Out: buf, OSC9: true, failed: map[string]bool{}}
+
+	tn.PushEvent(Event{Type: Start, Block: "*.go"})
+	if !strings.HasSuffix(buf.String(), "\033]0;modd: running *.go\007") {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+	buf.Reset()
+	tn.PushEvent(Event{Type: Failure, Title: "modd error", Block: "*.go"})
+	expected := "\033]9;modd error: *.go\007\033]0;modd: failed *.go\007"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+	buf.Reset()
+	tn.PushEvent(Event{Type: Start, Block: "*.js"})
+	tn.PushEvent(Event{Type: Success, Block: "*.js"})
+	if tn.Status() != "failed *.go" {
+		t.Errorf("Unexpected status: %q", tn.Status())
+	}
+	tn.PushEvent(Event{Type: Recovery, Title: "modd recovered\nnow", Block: "*.go"})
+	if tn.Status() != "ok" {
+		t.Errorf("Unexpected status: %q", tn.Status())
+	}
+	if !strings.Contains(buf.String(), "\033]9;modd recovered now: *.go\007") {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cortesi/modd/shell"
+	"github.com/cortesi/termlog"
+)
+
+// MaxWebhookOutput is the maximum number of bytes of command output included
+// in a webhook payload. Longer output is truncated from the front, since the
+// most useful information is usually at the end.
+const MaxWebhookOutput = 4096
+
+// WebhookNotifier POSTs a JSON representation of each event to a URL
+type WebhookNotifier struct {
+	URL string
+	// Headers are added to every request
+	Headers map[string]string
+	// Retries is the number of times a failed request is retried
+	Retries int
+	// RetryDelay is the delay before the first retry. The delay doubles with
+	// each subsequent retry.
+	RetryDelay time.Duration
+	// Client is the HTTP client used to make requests. If nil, a client with a
+	// 10 second timeout is used.
+	Client *http.Client
+	// Log reports events that couldn't be posted in the background. It may be
+	// nil.
+	Log termlog.Logger
+
+	// Events being posted in the background
+	pending sync.WaitGroup
+}
+
+// NewWebhookNotifier creates a WebhookNotifier with sensible defaults
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:        url,
+		Headers:    map[string]string{},
+		Retries:    3,
+		RetryDelay: 500 * time.Millisecond,
+	}
+}
+
+// Push implements Notifier
+func (w *WebhookNotifier) Push(title string, text string, iconPath string) {
+	now := time.Now()
+	w.PushEvent(Event{Title: title, Text: text, Start: now, End: now})
+}
+
+// PushEvent implements EventNotifier. The event is posted in the background,
+// and failures are reported to Log.
+func (w *WebhookNotifier) PushEvent(e Event) {
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		if err := w.Post(e); err != nil && w.Log != nil {
+			w.Log.Shout("Error posting webhook: %s", err)
+		}
+	}()
+}
+
+// Wait waits for events being posted in the background to be delivered, or
+// to fail
+func (w *WebhookNotifier) Wait() {
+	w.pending.Wait()
+}
+
+// Post synchronously posts an event, retrying on failure
+func (w *WebhookNotifier) Post(e Event) error {
+	e.Output = shell.Tail(e.Output, MaxWebhookOutput)
+	e.Stderr = shell.Tail(e.Stderr, MaxWebhookOutput)
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	delay := w.RetryDelay
+	for i := 0; ; i++ {
+		err = w.post(client, body)
+		if err == nil || i >= w.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *WebhookNotifier) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
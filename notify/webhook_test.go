@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		err := json.NewDecoder(r.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("Decoding payload: %s", err)
+		}
+	}))
+	defer ts.Close()
+
+	w := NewWebhookNotifier(ts.URL)
+	w.Headers["Authorization"] = "Bearer token"
+	e := Event{
+		Type:     Failure,
+		Title:    "modd error",
+		Block:    "**/*.go",
+		Command:  "go test",
+		ExitCode: 1,
+		Stderr:   strings.Repeat("x", MaxWebhookOutput) + "tail",
+		Start:    time.Now(),
+		End:      time.Now(),
+	}
+	err := w.Post(e)
+	if err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("Expected Authorization header, got %q", auth)
+	}
+	if got.Type != Failure || got.Command != "go test" || got.ExitCode != 1 {
+		t.Errorf("Unexpected payload: %#v", got)
+	}
+	if len(got.Stderr) != MaxWebhookOutput || !strings.HasSuffix(got.Stderr, "tail") {
+		t.Errorf("Expected truncated stderr, got %d bytes", len(got.Stderr))
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	w := NewWebhookNotifier(ts.URL)
+	w.RetryDelay = time.Millisecond
+	w.Retries = 1
+	if err := w.Post(Event{}); err == nil {
+		t.Errorf("Expected error after exhausting retries")
+	}
+	requests = 0
+	w.Retries = 2
+	if err := w.Post(Event{}); err != nil {
+		t.Errorf("Expected success after retries, got %s", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+}
+
+func TestWebhookPushEvent(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	lt := termlog.NewLogTest()
+	w := NewWebhookNotifier(ts.URL)
+	w.RetryDelay = time.Millisecond
+	w.Retries = 1
+	w.Log = lt.Log
+	w.PushEvent(Event{Type: Failure})
+	w.Wait()
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+	if !strings.Contains(lt.String(), "Error posting webhook: webhook returned status 500") {
+		t.Errorf("Expected error to be logged, got %q", lt.String())
+	}
+}
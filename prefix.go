@@ -0,0 +1,250 @@
+package modd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/termlog"
+	"github.com/fatih/color"
+)
+
+// The maximum length of a label derived from a command
+const maxLabelLength = 16
+
+// Colors for command labels, assigned to commands in the order they appear in
+// the config file
+var labelColors = []*color.Color{
+	color.New(color.FgCyan),
+	color.New(color.FgMagenta),
+	color.New(color.FgGreen),
+	color.New(color.FgBlue),
+	color.New(color.FgHiCyan),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiGreen),
+	color.New(color.FgHiBlue),
+}
+
+// commandLabel returns the label used to identify a command's output - either
+// the label given with +name, or the command's short name.
+func commandLabel(opts conf.CommandOptions, command string) string {
+	if opts.Name != "" {
+		return opts.Name
+	}
+	label := shortCommand(command)
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		label = string([]rune(label)[:maxLabelLength-1]) + "…"
+	}
+	return label
+}
+
+// Labels holds the label that identifies each command in a config. Labels are
+// unique: if different commands would share a label, the later ones get a
+// numeric suffix.
+type Labels struct {
+	labels map[string]string
+	// The distinct labels, in the order their commands appear in the config
+	order []string
+}
+
+// labelKey identifies a command for Labels. Commands with the same text and
+// +name are the same command, wherever they appear.
+func labelKey(opts conf.CommandOptions, command string) string {
+	return opts.Name + "\x00" + command
+}
+
+// NewLabels assigns labels to the commands in a config
+func NewLabels(cnf *conf.Config) *Labels {
+	l := &Labels{labels: map[string]string{}}
+	used := map[string]bool{}
+	add := func(opts conf.CommandOptions, command string) {
+		key := labelKey(opts, command)
+		if _, ok := l.labels[key]; ok {
+			return
+		}
+		base := commandLabel(opts, command)
+		label := base
+		for n := 2; used[label]; n++ {
+			label = fmt.Sprintf("%s#%d", base, n)
+		}
+		used[label] = true
+		l.labels[key] = label
+		l.order = append(l.order, label)
+	}
+	for _, b := range cnf.Blocks {
+		for _, d := range b.Daemons {
+			add(d.CommandOptions, d.Command)
+		}
+		for _, prep := range b.Preps {
+			add(prep.CommandOptions, prep.Command)
+		}
+		for _, hooks := range [][]string{b.OnFail, b.OnSuccess, b.OnRecover} {
+			for _, h := range hooks {
+				add(conf.CommandOptions{}, h)
+			}
+		}
+	}
+	return l
+}
+
+// Label returns the label of a command. Commands that aren't in the config
+// have the label returned by commandLabel.
+func (l *Labels) Label(opts conf.CommandOptions, command string) string {
+	if l != nil {
+		if label, ok := l.labels[labelKey(opts, command)]; ok {
+			return label
+		}
+	}
+	return commandLabel(opts, command)
+}
+
+// prefixer renders the prefixes for the output of each command in a config.
+// Labels are padded to the same width, and each label has its own color.
+type prefixer struct {
+	width  int
+	colors map[string]*color.Color
+}
+
+func newPrefixer(labels *Labels) *prefixer {
+	p := &prefixer{colors: map[string]*color.Color{}}
+	for i, label := range labels.order {
+		p.colors[label] = labelColors[i%len(labelColors)]
+		if n := utf8.RuneCountInString(label); n > p.width {
+			p.width = n
+		}
+	}
+	return p
+}
+
+// prefix returns the rendered prefix for a command's label
+func (p *prefixer) prefix(label string) string {
+	c, ok := p.colors[label]
+	if !ok {
+		c = labelColors[0]
+	}
+	pad := p.width - utf8.RuneCountInString(label)
+	if pad < 0 {
+		pad = 0
+	}
+	return c.Sprint(label+strings.Repeat(" ", pad)) + " | "
+}
+
+// commandLog is a log that handles the output of each command itself, rather
+// than through a stream with a header.
+type commandLog interface {
+	termlog.TermLog
+	// CommandStream returns the stream for the output of a command in the
+	// block with the given index. The kind is "prep", "daemon" or the kind of
+	// hook, and the label identifies the command.
+	CommandStream(block int, kind string, label string) termlog.Stream
+}
+
+// prefixLog is a log that prefixes each line of command output with a label,
+// rather than printing a header when output switches between commands.
+type prefixLog struct {
+	termlog.TermLog
+	prefixer *prefixer
+}
+
+// CommandStream implements commandLog
+func (pl *prefixLog) CommandStream(block int, kind string, label string) termlog.Stream {
+	return &prefixStream{log: pl.TermLog, prefix: pl.prefixer.prefix(label)}
+}
+
+// commandStream returns the stream for the output of a command in block b,
+// which is block i in the config. The command has the given label and is
+// rendered as rendered. If log is a
+// commandLog, it handles the output, otherwise the stream has a header made
+// from the kind and the command's +name or rendered command. If log is a
+// recordLog, the output is also recorded.
+func commandStream(
+	log termlog.TermLog,
+	i int,
+	b conf.Block,
+	kind string,
+	opts conf.CommandOptions,
+	label string,
+	rendered string,
+) termlog.Stream {
+	if rl, ok := log.(*recordLog); ok {
+		return &recordStream{
+			Stream: commandStream(rl.TermLog, i, b, kind, opts, label, rendered),
+			record: func(text string) {
+				rl.recorder.RecordOutput(i, kind, label, text)
+			},
+		}
+	}
+	if cl, ok := log.(commandLog); ok {
+		return cl.CommandStream(i, kind, label)
+	}
+	if opts.Name != "" {
+		rendered = opts.Name
+	}
+	return log.Stream(niceHeader(kind+": ", rendered))
+}
+
+// prefixStream is a stream that writes each line to the top-level log with a
+// prefix. Only the text following the prefix takes the color of the log level.
+type prefixStream struct {
+	log    termlog.Logger
+	prefix string
+	quiet  bool
+}
+
+// Say logs a line
+func (s *prefixStream) Say(format string, args ...interface{}) {
+	s.SayAs("", format, args...)
+}
+
+// Notice logs a line with the Notice color
+func (s *prefixStream) Notice(format string, args ...interface{}) {
+	s.NoticeAs("", format, args...)
+}
+
+// Warn logs a line with the Warn color
+func (s *prefixStream) Warn(format string, args ...interface{}) {
+	s.WarnAs("", format, args...)
+}
+
+// Shout logs a line with the Shout color
+func (s *prefixStream) Shout(format string, args ...interface{}) {
+	s.ShoutAs("", format, args...)
+}
+
+// SayAs logs a line
+func (s *prefixStream) SayAs(name string, format string, args ...interface{}) {
+	s.output(name, termlog.DefaultPalette.Say, format, args)
+}
+
+// NoticeAs logs a line with the Notice color
+func (s *prefixStream) NoticeAs(name string, format string, args ...interface{}) {
+	s.output(name, termlog.DefaultPalette.Notice, format, args)
+}
+
+// WarnAs logs a line with the Warn color
+func (s *prefixStream) WarnAs(name string, format string, args ...interface{}) {
+	s.output(name, termlog.DefaultPalette.Warn, format, args)
+}
+
+// ShoutAs logs a line with the Shout color
+func (s *prefixStream) ShoutAs(name string, format string, args ...interface{}) {
+	s.output(name, termlog.DefaultPalette.Shout, format, args)
+}
+
+func (s *prefixStream) output(
+	name string, c *color.Color, format string, args []interface{},
+) {
+	if s.quiet {
+		return
+	}
+	s.log.SayAs(name, "%s%s", s.prefix, c.Sprintf(format, args...))
+}
+
+// Quiet disables output for this stream
+func (s *prefixStream) Quiet() {
+	s.quiet = true
+}
+
+// Header does nothing, since every line identifies the command
+func (s *prefixStream) Header() {}
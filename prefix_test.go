@@ -0,0 +1,137 @@
+package modd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/termlog"
+)
+
+var commandLabelTests = []struct {
+	name     string
+	command  string
+	expected string
+}{
+	{"", "go test", "go test"},
+	{"web", "go run ./cmd/server", "web"},
+	{"", "# server\n./server --port 8080", "server"},
+	{"", "go run ./cmd/server --port 8080", "go run ./cmd/se…"},
+}
+
+func TestCommandLabel(t *testing.T) {
+	for i, tst := range commandLabelTests {
+		result := commandLabel(conf.CommandOptions{Name: tst.name}, tst.command)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	server := conf.Daemon{Command: "go run ./cmd/server"}
+	cnf := &conf.Config{
+		Blocks: []conf.Block{
+			{
+				Daemons: []conf.Daemon{
+					server,
+					{Command: "go run ./cmd/search"},
+					{Command: "./web", CommandOptions: conf.CommandOptions{Name: "web"}},
+				},
+				Preps: []conf.Prep{{Command: "./build", CommandOptions: conf.CommandOptions{Name: "web"}}},
+			},
+			{Daemons: []conf.Daemon{server}},
+		},
+	}
+	l := NewLabels(cnf)
+	tests := []struct {
+		opts     conf.CommandOptions
+		command  string
+		expected string
+	}{
+		{conf.CommandOptions{}, "go run ./cmd/server", "go run ./cmd/se…"},
+		{conf.CommandOptions{}, "go run ./cmd/search", "go run ./cmd/se…#2"},
+		{conf.CommandOptions{Name: "web"}, "./web", "web"},
+		{conf.CommandOptions{Name: "web"}, "./build", "web#2"},
+		{conf.CommandOptions{}, "not in config", "not in config"},
+	}
+	for i, tst := range tests {
+		if result := l.Label(tst.opts, tst.command); result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+	if len(l.order) != 4 {
+		t.Errorf("expected 4 distinct labels, got %q", l.order)
+	}
+}
+
+func TestPrefixStream(t *testing.T) {
+	lt := termlog.NewLogTest()
+	cnf := &conf.Config{
+		Blocks: []conf.Block{
+			{
+				Daemons: []conf.Daemon{
+					{Command: "./server", CommandOptions: conf.CommandOptions{Name: "web"}},
+					{Command: "./worker"},
+				},
+				Preps: []conf.Prep{{Command: "./server"}},
+			},
+		},
+	}
+	p := newPrefixer(NewLabels(cnf))
+	if len(p.colors) != 3 || p.colors["web"] == p.colors["./worker"] {
+		t.Errorf("expected a distinct color for each label")
+	}
+	log := &prefixLog{TermLog: lt.Log, prefixer: p}
+
+	b := cnf.Blocks[0]
+	web := commandStream(log, 0, b, "daemon", b.Daemons[0].CommandOptions, "web", "./server")
+	worker := commandStream(log, 0, b, "daemon", conf.CommandOptions{}, "./worker", "./worker")
+	web.Header()
+	web.Say("one")
+	worker.Warn("two")
+	web.Say("three")
+
+	out := lt.String()
+	for _, l := range []string{"web      | one", "./worker | two", "web      | three"} {
+		if !strings.Contains(out, l) {
+			t.Errorf("expected %q in output:\n%s", l, out)
+		}
+	}
+	if strings.Contains(out, "daemon:") {
+		t.Errorf("unexpected header in output:\n%s", out)
+	}
+}
+
+type testRecorder struct {
+	lines []string
+}
+
+func (r *testRecorder) RecordOutput(block int, kind string, name string, text string) {
+	r.lines = append(r.lines, fmt.Sprintf("%d %s %s: %s", block, kind, name, text))
+}
+
+func TestRecordStream(t *testing.T) {
+	lt := termlog.NewLogTest()
+	rec := &testRecorder{}
+	log := &recordLog{TermLog: lt.Log, recorder: rec}
+	b := conf.Block{
+		Include: []string{"*.go"},
+		Preps:   []conf.Prep{{Command: "go test ./...", CommandOptions: conf.CommandOptions{Name: "test"}}},
+	}
+
+	s := commandStream(log, 2, b, "prep", b.Preps[0].CommandOptions, "test", "go test ./...")
+	s.Header()
+	s.Say("ok %s", "pkg")
+	s.Shout("FAIL")
+
+	expected := "2 prep test: ok pkg|2 prep test: FAIL"
+	if got := strings.Join(rec.lines, "|"); got != expected {
+		t.Errorf("expected recorded output %q, got %q", expected, got)
+	}
+	out := lt.String()
+	if !strings.Contains(out, "prep: test") || !strings.Contains(out, "ok pkg") {
+		t.Errorf("expected output in log:\n%s", out)
+	}
+}
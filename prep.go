@@ -1,6 +1,11 @@
 package modd
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cortesi/modd/conf"
@@ -14,42 +19,143 @@ import (
 // ProcError is a process error, possibly containing command output
 type ProcError struct {
 	shorttext string
-	Output    string
+	// The tail of the command's combined stdout and stderr
+	Output string
+	// The command's stderr
+	Stderr   string
+	Command  string
+	TimedOut bool
+	// NonFatal is true if the failed prep was marked +noerr, and execution of
+	// the block continued
+	NonFatal bool
+	shell.ExitInfo
 }
 
 func (p ProcError) Error() string {
 	return p.shorttext
 }
 
-// RunProc runs a process to completion, sending output to log
-func RunProc(cmd string, shellMethod string, dir string, log termlog.Stream) error {
+// RunProc runs a process to completion, sending output to log. If ctx is
+// cancelled, the process is stopped and ctx's error is returned.
+func RunProc(ctx context.Context, ex *shell.Executor, log termlog.Stream) error {
 	log.Header()
-	ex, err := shell.NewExecutor(shellMethod, cmd, dir)
-	if err != nil {
-		return err
-	}
-	start := time.Now()
-	err, estate := ex.Run(log, true)
+	err, estate := ex.RunContext(ctx, log, true)
 	if err != nil {
 		return err
+	} else if ctx.Err() != nil {
+		log.Notice(">> stopped")
+		return ctx.Err()
+	} else if estate.TimedOut {
+		msg := fmt.Sprintf("timed out after %s", ex.Timeout)
+		log.Shout("%s", msg)
+		return ProcError{
+			shorttext: msg,
+			Output:    estate.Output,
+			Stderr:    estate.ErrOutput,
+			Command:   ex.Command,
+			TimedOut:  true,
+			ExitInfo:  estate.ExitInfo,
+		}
 	} else if estate.Error != nil {
-		log.Shout("%s", estate.Error)
-		return ProcError{estate.Error.Error(), estate.ErrOutput}
+		log.Shout("%s (%s)", estate.Error, usageSummary(estate.ExitInfo))
+		return ProcError{
+			shorttext: estate.Error.Error(),
+			Output:    estate.Output,
+			Stderr:    estate.ErrOutput,
+			Command:   ex.Command,
+			ExitInfo:  estate.ExitInfo,
+		}
 	}
-	log.Notice(">> done (%s)", time.Since(start))
+	log.Notice(">> done (%s)", usageSummary(estate.ExitInfo))
 	return nil
 }
 
-// RunPreps runs all commands in sequence. Stops if any command returns an error.
+// usageSummary formats the run time and resource usage of a process
+func usageSummary(info shell.ExitInfo) string {
+	parts := []string{info.WallTime.String()}
+	if info.UserTime > 0 || info.SysTime > 0 {
+		parts = append(
+			parts,
+			fmt.Sprintf("user %s", info.UserTime.Round(time.Millisecond)),
+			fmt.Sprintf("sys %s", info.SysTime.Round(time.Millisecond)),
+		)
+	}
+	if info.MaxRSS > 0 {
+		parts = append(parts, fmt.Sprintf("max rss %.1fMB", float64(info.MaxRSS)/(1<<20)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// defaultTimeout returns the global prep timeout specified in vars, or 0 if
+// there is none.
+func defaultTimeout(vars map[string]string) (time.Duration, error) {
+	v := vars[prepTimeoutVarName]
+	if v == "" {
+		return 0, nil
+	}
+	return conf.ParseTimeout(v)
+}
+
+// outputOptions returns the limit on the amount of output captured from
+// failed commands, and the pattern used to extract relevant lines from it, as
+// specified in vars. The limit is 0 and the pattern nil if they're not set.
+func outputOptions(vars map[string]string) (int, *regexp.Regexp, error) {
+	limit := 0
+	if v := vars[outputLimitVarName]; v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return 0, nil, fmt.Errorf("invalid %s: %q", outputLimitVarName, v)
+		}
+		limit = l
+	}
+	var match *regexp.Regexp
+	if v := vars[outputMatchVarName]; v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid %s: %s", outputMatchVarName, err)
+		}
+		match = re
+	}
+	return limit, match, nil
+}
+
+// extractOutput returns the lines of output that match re. If re is nil, or
+// no lines match, the output is returned unchanged.
+func extractOutput(output string, re *regexp.Regexp) string {
+	if re == nil {
+		return output
+	}
+	matched := []string{}
+	for _, l := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if re.MatchString(l) {
+			matched = append(matched, l)
+		}
+	}
+	if len(matched) == 0 {
+		return output
+	}
+	return strings.Join(matched, "\n") + "\n"
+}
+
+// RunPreps runs all commands in sequence. Stops if any command returns an
+// error, unless the command is marked +noerr. If only +noerr commands fail, the
+// first of their errors is returned with NonFatal set.
 func RunPreps(
+	ctx context.Context,
+	i int,
 	b conf.Block,
 	vars map[string]string,
+	labels *Labels,
 	mod *moddwatch.Mod,
 	log termlog.TermLog,
 	notifiers []notify.Notifier,
 	initial bool,
 ) error {
-	sh, err := shell.GetShellName(vars[shellVarName])
+	deftimeout, err := defaultTimeout(vars)
+	if err != nil {
+		return err
+	}
+	outlimit, outmatch, err := outputOptions(vars)
 	if err != nil {
 		return err
 	}
@@ -59,8 +165,17 @@ func RunPreps(
 		modified = mod.All()
 	}
 
+	var nonfatal error
 	vcmd := varcmd.VarCmd{Block: &b, Modified: modified, Vars: vars}
 	for _, p := range b.Preps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sh, err := commandShell(p.CommandOptions, b, vars)
+		if err != nil {
+			return err
+		}
+		vcmd.Shell = sh
 		cmd, err := vcmd.Render(p.Command)
 		if initial && p.Onchange {
 			log.Say(niceHeader("skipping prep: ", cmd))
@@ -69,15 +184,69 @@ func RunPreps(
 		if err != nil {
 			return err
 		}
-		err = RunProc(cmd, sh, b.InDir, log.Stream(niceHeader("prep: ", cmd)))
+		timeout := p.Timeout
+		if timeout == 0 {
+			timeout = deftimeout
+		}
+		ex, err := shell.NewExecutor(sh, cmd, b.InDir)
+		if err != nil {
+			return err
+		}
+		ex.Timeout = timeout
+		ex.LogFile = openLog("prep", cmd, p.CommandOptions, vars, log)
+		ex.Pty = p.Pty
+		ex.Drop = p.Drop
+		ex.Highlight = p.Highlight
+		ex.Quiet = p.Quiet
+		ex.InProcess = true
+		ex.OutputLimit = outlimit
+		ex.Notify = notifyFunc(i, b, cmd, notifiers)
+		label := labels.Label(p.CommandOptions, p.Command)
+		start := time.Now()
+		err = RunProc(ctx, ex, commandStream(log, i, b, "prep", p.CommandOptions, label, cmd))
+		if ex.LogFile != nil {
+			ex.LogFile.Close()
+		}
 		if err != nil {
 			if pe, ok := err.(ProcError); ok {
+				pe.Output = extractOutput(pe.Output, outmatch)
+				e := notify.Event{
+					Type:       notify.Failure,
+					Title:      "modd error",
+					Text:       pe.Output,
+					Block:      blockName(b),
+					BlockIndex: i,
+					Command:    cmd,
+					Name:       label,
+					ExitCode:   pe.ExitCode,
+					Signal:     pe.Signal,
+					UserTime:   pe.UserTime.Seconds(),
+					SysTime:    pe.SysTime.Seconds(),
+					MaxRSS:     pe.MaxRSS,
+					Output:     pe.Output,
+					Stderr:     pe.Stderr,
+					Start:      start,
+					End:        time.Now(),
+				}
+				if pe.TimedOut {
+					e.Type = notify.Timeout
+					e.Title = "modd timeout"
+				}
 				for _, n := range notifiers {
-					n.Push("modd error", pe.Output, "")
+					notify.Send(n, e)
 				}
+				if p.NoErr {
+					log.Warn("prep failed, continuing: %s", shortCommand(cmd))
+					if nonfatal == nil {
+						pe.NonFatal = true
+						nonfatal = pe
+					}
+					continue
+				}
+				return pe
 			}
 			return err
 		}
 	}
-	return nil
+	return nonfatal
 }
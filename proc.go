@@ -3,12 +3,23 @@ package modd
 import (
 	"bufio"
 	"io"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/notify"
+	"github.com/cortesi/modd/shell"
 	"github.com/cortesi/termlog"
 )
 
+// Characters permitted in generated log file names
+const logNameRunes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-_"
+
+// The maximum length of the command portion of a generated log file name
+const maxLogName = 60
+
 // shortCommand shortens a command to a name we can use in a notification
 // header.
 func shortCommand(command string) string {
@@ -25,6 +36,94 @@ func shortCommand(command string) string {
 	return ret
 }
 
+// blockName produces a short name for a block to use in notifications, based
+// on its include patterns.
+func blockName(b conf.Block) string {
+	if len(b.Include) == 0 {
+		return "{}"
+	}
+	return strings.Join(b.Include, " ")
+}
+
+// logName produces a file name for a command's log file
+func logName(kind string, command string) string {
+	name := strings.Map(
+		func(r rune) rune {
+			if strings.ContainsRune(logNameRunes, r) {
+				return r
+			}
+			return '_'
+		},
+		shortCommand(command),
+	)
+	if len(name) > maxLogName {
+		name = name[:maxLogName]
+	}
+	return kind + "-" + strings.Trim(name, "_") + ".log"
+}
+
+// openLog opens the log file for a command. The path is taken from the
+// command's +log option, or generated from the command in the @logdir
+// directory. Returns nil if the command isn't logged. Errors are reported to
+// log, and the command then runs without a log file.
+func openLog(
+	kind string, command string, opts conf.CommandOptions,
+	vars map[string]string, log termlog.Logger,
+) *shell.LogFile {
+	path := opts.Log
+	if path == "" && vars[logDirVarName] != "" {
+		path = filepath.Join(vars[logDirVarName], logName(kind, command))
+	}
+	if path == "" {
+		return nil
+	}
+	lf, err := shell.OpenLogFile(path)
+	if err != nil {
+		log.Warn("Could not open log file: %s", err)
+		return nil
+	}
+	return lf
+}
+
+// blockShell returns the shell used by a block's commands - either the
+// block's own @shell, or the global @shell.
+func blockShell(b conf.Block, vars map[string]string) (string, error) {
+	if b.Shell != "" {
+		return shell.GetShellName(b.Shell)
+	}
+	return shell.GetShellName(vars[shellVarName])
+}
+
+// commandShell returns the shell used to run a command in block b. The
+// command's +shell option takes precedence over the block's shell.
+func commandShell(opts conf.CommandOptions, b conf.Block, vars map[string]string) (string, error) {
+	if opts.Shell != "" {
+		return shell.GetShellName(opts.Shell)
+	}
+	return blockShell(b, vars)
+}
+
+// notifyFunc returns the function used by the notify builtin in a command in
+// block b, which is block i in the config. It sends a message to all notifiers.
+func notifyFunc(i int, b conf.Block, cmd string, notifiers []notify.Notifier) shell.NotifyFunc {
+	return func(title string, body string) {
+		now := time.Now()
+		e := notify.Event{
+			Type:       notify.Message,
+			Title:      title,
+			Text:       body,
+			Block:      blockName(b),
+			BlockIndex: i,
+			Command:    cmd,
+			Start:      now,
+			End:        now,
+		}
+		for _, n := range notifiers {
+			notify.Send(n, e)
+		}
+	}
+}
+
 // niceHeader tries to produce a nicer process name. We condense whitespace to
 // make commands split over multiple lines with indentation more legible, and
 // limit the line length to 80 characters.
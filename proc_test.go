@@ -1,6 +1,13 @@
 package modd
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cortesi/modd/conf"
+	"github.com/cortesi/modd/shell"
+)
 
 var shortCommandTests = []struct {
 	command  string
@@ -25,3 +32,106 @@ func TestShortCommand(t *testing.T) {
 		}
 	}
 }
+
+var commandShellTests = []struct {
+	global   string
+	block    string
+	command  string
+	expected string
+}{
+	{"", "", "", "modd"},
+	{"bash", "", "", "bash"},
+	{"bash", "zsh", "", "zsh"},
+	{"bash", "zsh", "fish", "fish"},
+	{"", "", "exec", "exec"},
+}
+
+func TestCommandShell(t *testing.T) {
+	for i, tst := range commandShellTests {
+		b := conf.Block{Shell: tst.block}
+		opts := conf.CommandOptions{Shell: tst.command}
+		vars := map[string]string{shellVarName: tst.global}
+		result, err := commandShell(opts, b, vars)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", i, err)
+		} else if result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+	_, err := commandShell(conf.CommandOptions{}, conf.Block{Shell: "csh"}, nil)
+	if err == nil {
+		t.Error("Expected error for unsupported shell")
+	}
+}
+
+var usageSummaryTests = []struct {
+	info     shell.ExitInfo
+	expected string
+}{
+	{shell.ExitInfo{WallTime: time.Second}, "1s"},
+	{
+		shell.ExitInfo{
+			WallTime: 1500 * time.Millisecond,
+			UserTime: 1200 * time.Millisecond,
+			SysTime:  100 * time.Millisecond,
+			MaxRSS:   3 << 20,
+		},
+		"1.5s, user 1.2s, sys 100ms, max rss 3.0MB",
+	},
+}
+
+func TestUsageSummary(t *testing.T) {
+	for i, tst := range usageSummaryTests {
+		result := usageSummary(tst.info)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+}
+
+var extractOutputTests = []struct {
+	output   string
+	match    string
+	expected string
+}{
+	{"one\ntwo\n", "", "one\ntwo\n"},
+	{"one\ntwo\n", "^t", "two\n"},
+	{"a.go:1: x\nok\nb.go:2: y\n", `\.go:\d+`, "a.go:1: x\nb.go:2: y\n"},
+	{"one\ntwo\n", "three", "one\ntwo\n"},
+}
+
+func TestExtractOutput(t *testing.T) {
+	for i, tst := range extractOutputTests {
+		var re *regexp.Regexp
+		if tst.match != "" {
+			re = regexp.MustCompile(tst.match)
+		}
+		result := extractOutput(tst.output, re)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+}
+
+func TestOutputOptions(t *testing.T) {
+	limit, match, err := outputOptions(map[string]string{})
+	if err != nil || limit != 0 || match != nil {
+		t.Errorf("unexpected defaults: %d %v %v", limit, match, err)
+	}
+	limit, match, err = outputOptions(map[string]string{
+		outputLimitVarName: "100",
+		outputMatchVarName: "error",
+	})
+	if err != nil || limit != 100 || match == nil {
+		t.Errorf("unexpected options: %d %v %v", limit, match, err)
+	}
+	for _, vars := range []map[string]string{
+		{outputLimitVarName: "foo"},
+		{outputLimitVarName: "-1"},
+		{outputMatchVarName: "("},
+	} {
+		if _, _, err := outputOptions(vars); err == nil {
+			t.Errorf("expected error for %v", vars)
+		}
+	}
+}
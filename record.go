@@ -0,0 +1,52 @@
+package modd
+
+import (
+	"fmt"
+
+	"github.com/cortesi/termlog"
+)
+
+// An outputRecorder receives a copy of each line of command output
+type outputRecorder interface {
+	// RecordOutput records a line of output from a command in the block with
+	// the given index. The kind is "prep", "daemon" or the kind of hook, and
+	// the name is the command's label.
+	RecordOutput(block int, kind string, name string, text string)
+}
+
+// recordLog is a log that sends a copy of all command output to a recorder
+type recordLog struct {
+	termlog.TermLog
+	recorder outputRecorder
+}
+
+// recordStream is a stream that sends a copy of everything written to it to a
+// recorder
+type recordStream struct {
+	termlog.Stream
+	record func(text string)
+}
+
+// Say logs a line
+func (s *recordStream) Say(format string, args ...interface{}) {
+	s.Stream.Say(format, args...)
+	s.record(fmt.Sprintf(format, args...))
+}
+
+// Notice logs a line with the Notice color
+func (s *recordStream) Notice(format string, args ...interface{}) {
+	s.Stream.Notice(format, args...)
+	s.record(fmt.Sprintf(format, args...))
+}
+
+// Warn logs a line with the Warn color
+func (s *recordStream) Warn(format string, args ...interface{}) {
+	s.Stream.Warn(format, args...)
+	s.record(fmt.Sprintf(format, args...))
+}
+
+// Shout logs a line with the Shout color
+func (s *recordStream) Shout(format string, args ...interface{}) {
+	s.Stream.Shout(format, args...)
+	s.record(fmt.Sprintf(format, args...))
+}
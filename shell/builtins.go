@@ -0,0 +1,370 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// How often the wait-for builtins check their condition
+const waitInterval = 100 * time.Millisecond
+
+// NotifyFunc sends a notification from the notify builtin
+type NotifyFunc func(title string, body string)
+
+// A builtin implements a command for the built-in shell. If the builtin
+// returns errFallback, the command is run as an external program instead.
+type builtin func(ctx context.Context, b *builtins, args []string) error
+
+var errFallback = fmt.Errorf("fallback")
+
+// builtinCommands are the modd-specific commands available in the built-in
+// shell. File manipulation commands are implemented here so that configs work
+// the same on systems without coreutils. When they're given options we don't
+// support, we fall back to the system's command.
+var builtinCommands = map[string]builtin{
+	"cp":            builtinCp,
+	"mkdir":         builtinMkdir,
+	"notify":        builtinNotify,
+	"rm":            builtinRm,
+	"touch":         builtinTouch,
+	"wait-for-file": builtinWaitForFile,
+	"wait-for-port": builtinWaitForPort,
+}
+
+// builtins holds the state needed by builtin commands
+type builtins struct {
+	notify NotifyFunc
+}
+
+// handler is an interp exec handler middleware that runs builtin commands
+func (b *builtins) handler(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		f, ok := builtinCommands[args[0]]
+		if !ok {
+			return next(ctx, args)
+		}
+		err := f(ctx, b, args[1:])
+		if err == errFallback {
+			return next(ctx, args)
+		} else if err != nil {
+			fmt.Fprintf(interp.HandlerCtx(ctx).Stderr, "%s: %s\n", args[0], err)
+			return interp.NewExitStatus(1)
+		}
+		return nil
+	}
+}
+
+// parseFlags splits leading single-letter flags from arguments. Returns
+// errFallback if a flag is not in allowed.
+func parseFlags(args []string, allowed string) (map[rune]bool, []string, error) {
+	flags := map[rune]bool{}
+	for len(args) > 0 {
+		a := args[0]
+		if a == "--" {
+			args = args[1:]
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			break
+		}
+		for _, r := range a[1:] {
+			if !strings.ContainsRune(allowed, r) {
+				return nil, nil, errFallback
+			}
+			flags[r] = true
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// absPath resolves a path relative to the shell's current directory
+func absPath(ctx context.Context, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(interp.HandlerCtx(ctx).Dir, p)
+}
+
+// isRoot returns true if p is the root of a filesystem
+func isRoot(p string) bool {
+	p = filepath.Clean(p)
+	return filepath.Dir(p) == p
+}
+
+// within returns true if p is dir, or a path inside dir. Both paths must be
+// absolute.
+func within(p string, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// waitFor calls check until it returns true, the context is cancelled, or the
+// optional timeout expires.
+func waitFor(ctx context.Context, timeout time.Duration, check func() bool) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	for !check() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("timed out after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// parseWaitArgs parses the arguments to the wait-for builtins, which take a
+// single target and an optional -t timeout.
+func parseWaitArgs(args []string) (string, time.Duration, error) {
+	var timeout time.Duration
+	if len(args) == 3 && args[0] == "-t" {
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid timeout: %q", args[1])
+		}
+		timeout = d
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		return "", 0, fmt.Errorf("usage: [-t TIMEOUT] TARGET")
+	}
+	return args[0], timeout, nil
+}
+
+func builtinWaitForPort(ctx context.Context, b *builtins, args []string) error {
+	addr, timeout, err := parseWaitArgs(args)
+	if err != nil {
+		return err
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+	return waitFor(ctx, timeout, func() bool {
+		conn, err := net.DialTimeout("tcp", addr, waitInterval)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	})
+}
+
+func builtinWaitForFile(ctx context.Context, b *builtins, args []string) error {
+	path, timeout, err := parseWaitArgs(args)
+	if err != nil {
+		return err
+	}
+	path = absPath(ctx, path)
+	return waitFor(ctx, timeout, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+}
+
+func builtinNotify(ctx context.Context, b *builtins, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: notify TITLE BODY")
+	}
+	if b.notify == nil {
+		return fmt.Errorf("only available in prep commands and hooks run by modd")
+	}
+	b.notify(args[0], args[1])
+	return nil
+}
+
+func builtinTouch(ctx context.Context, b *builtins, args []string) error {
+	_, args, err := parseFlags(args, "")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing file operand")
+	}
+	now := time.Now()
+	for _, p := range args {
+		p = absPath(ctx, p)
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if err := os.Chtimes(p, now, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func builtinRm(ctx context.Context, b *builtins, args []string) error {
+	flags, args, err := parseFlags(args, "rRf")
+	if err != nil {
+		return err
+	}
+	recursive := flags['r'] || flags['R']
+	if len(args) == 0 && !flags['f'] {
+		return fmt.Errorf("missing operand")
+	}
+	// Check every operand before removing anything, so that a bad operand
+	// doesn't leave a partial removal behind
+	cwd := interp.HandlerCtx(ctx).Dir
+	for i, p := range args {
+		if p == "" {
+			return fmt.Errorf("refusing to remove an empty path")
+		}
+		if base := filepath.Base(p); base == "." || base == ".." {
+			return fmt.Errorf("refusing to remove '.' or '..' directory: %s", p)
+		}
+		args[i] = absPath(ctx, p)
+		if isRoot(args[i]) {
+			return fmt.Errorf("refusing to remove %s", args[i])
+		}
+		if within(cwd, args[i]) {
+			return fmt.Errorf("refusing to remove %s, which contains the working directory", p)
+		}
+	}
+	for _, p := range args {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			if os.IsNotExist(err) && flags['f'] {
+				continue
+			}
+			return err
+		}
+		if fi.IsDir() && !recursive {
+			return fmt.Errorf("%s: is a directory", p)
+		}
+		if recursive {
+			err = os.RemoveAll(p)
+		} else {
+			err = os.Remove(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func builtinMkdir(ctx context.Context, b *builtins, args []string) error {
+	flags, args, err := parseFlags(args, "p")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing operand")
+	}
+	for _, p := range args {
+		p = absPath(ctx, p)
+		if flags['p'] {
+			err = os.MkdirAll(p, 0777)
+		} else {
+			err = os.Mkdir(p, 0777)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func builtinCp(ctx context.Context, b *builtins, args []string) error {
+	flags, args, err := parseFlags(args, "rR")
+	if err != nil {
+		return err
+	}
+	recursive := flags['r'] || flags['R']
+	if len(args) < 2 {
+		return fmt.Errorf("usage: cp [-r] SOURCE... DEST")
+	}
+	dst := absPath(ctx, args[len(args)-1])
+	srcs := args[:len(args)-1]
+	dstInfo, err := os.Stat(dst)
+	dstIsDir := err == nil && dstInfo.IsDir()
+	if len(srcs) > 1 && !dstIsDir {
+		return fmt.Errorf("%s: not a directory", dst)
+	}
+	for _, src := range srcs {
+		src = absPath(ctx, src)
+		target := dst
+		if dstIsDir {
+			target = filepath.Join(dst, filepath.Base(src))
+		}
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if targetInfo, err := os.Stat(target); err == nil && os.SameFile(srcInfo, targetInfo) {
+			return fmt.Errorf("%s and %s are the same file", src, target)
+		}
+		if srcInfo.IsDir() && within(target, src) {
+			return fmt.Errorf("cannot copy a directory, %s, into itself, %s", src, target)
+		}
+		if err := copyPath(src, target, recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyPath copies a file, or a directory tree if recursive is true
+func copyPath(src string, dst string, recursive bool) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return copyFile(src, dst, fi.Mode())
+	}
+	if !recursive {
+		return fmt.Errorf("%s: is a directory (not copied)", src)
+	}
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		}
+		return copyFile(p, target, fi.Mode())
+	})
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,252 @@
+package shell
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+func runBuiltinTest(t *testing.T, dir string, cmd string, notify NotifyFunc) (*ExecState, string) {
+	lt := termlog.NewLogTest()
+	ex, err := NewExecutor("modd", cmd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.InProcess = true
+	ex.Notify = notify
+	err, estate := ex.Run(lt.Log.Stream(""), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return estate, lt.String()
+}
+
+func TestBuiltinFiles(t *testing.T) {
+	dir := t.TempDir()
+	cmds := []string{
+		"mkdir -p a/b/c",
+		"touch a/b/one a/two",
+		"cp -r a copy",
+		"cp a/two three",
+		"mkdir dst && cp a/two three dst",
+		"rm -rf a",
+		"rm three",
+		"rm -f nonexistent",
+	}
+	for _, cmd := range cmds {
+		estate, out := runBuiltinTest(t, dir, cmd, nil)
+		if estate.Error != nil {
+			t.Fatalf("%s: %s\n%s", cmd, estate.Error, out)
+		}
+	}
+	for _, p := range []string{"copy/b/c", "copy/b/one", "copy/two", "dst/two", "dst/three"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Errorf("expected %s to exist", p)
+		}
+	}
+	for _, p := range []string{"a", "three"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", p)
+		}
+	}
+
+	failures := []string{
+		"mkdir copy",
+		"rm copy",
+		"rm nonexistent",
+		"cp copy elsewhere",
+		"cp copy/two nonexistent/two",
+		"touch",
+	}
+	for _, cmd := range failures {
+		estate, _ := runBuiltinTest(t, dir, cmd, nil)
+		if estate.Error == nil {
+			t.Errorf("%s: expected error", cmd)
+		}
+	}
+}
+
+func TestBuiltinRmRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// These are run without -r, so that a regression can't remove anything
+	// that matters
+	for _, cmd := range []string{
+		"rm keep /",
+		"rm keep $MODD_UNSET_TEST/",
+		"rm -f keep ''",
+		"rm -f keep \"$MODD_UNSET_TEST\"",
+		"rm keep .",
+		"rm keep ..",
+		"rm keep sub/.",
+		"rm keep ./",
+		"rm keep \"$PWD\"",
+		"rm keep \"${PWD%/*}\"",
+	} {
+		estate, out := runBuiltinTest(t, dir, cmd, nil)
+		if estate.Error == nil || !strings.Contains(out, "refusing to remove") {
+			t.Errorf("%s: expected refusal, got %v\n%s", cmd, estate.Error, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keep")); err != nil {
+		t.Error("expected operands to be checked before removing anything")
+	}
+}
+
+func TestBuiltinRmWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	proj := filepath.Join(dir, "proj")
+	if err := os.MkdirAll(filepath.Join(proj, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"rm -rf .", "rm -rf ..", "rm -rf sub/..", "rm -rf \"$PWD\""} {
+		estate, out := runBuiltinTest(t, proj, cmd, nil)
+		if estate.Error == nil || !strings.Contains(out, "refusing to remove") {
+			t.Errorf("%s: expected refusal, got %v\n%s", cmd, estate.Error, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(proj, "sub")); err != nil {
+		t.Error("expected the working directory to survive")
+	}
+}
+
+func TestBuiltinCpSameFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tree", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{
+		"cp a.txt .",
+		"cp a.txt a.txt",
+		"cp a.txt ./a.txt",
+		"cp -r tree tree/sub",
+		"cp -r tree tree",
+	} {
+		estate, out := runBuiltinTest(t, dir, cmd, nil)
+		if estate.Error == nil {
+			t.Errorf("%s: expected error\n%s", cmd, out)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "data" {
+		t.Errorf("expected a.txt to be unchanged, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tree", "sub", "tree")); !os.IsNotExist(err) {
+		t.Error("expected no copy of the tree inside itself")
+	}
+}
+
+func TestWithin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test paths are POSIX")
+	}
+	tests := []struct {
+		path     string
+		dir      string
+		expected bool
+	}{
+		{"/a/b", "/a/b", true},
+		{"/a/b/c", "/a/b", true},
+		{"/a/b", "/", true},
+		{"/a", "/a/b", false},
+		{"/a/bc", "/a/b", false},
+		{"/a/..b", "/a", true},
+	}
+	for _, tt := range tests {
+		if within(tt.path, tt.dir) != tt.expected {
+			t.Errorf("within(%q, %q): expected %v", tt.path, tt.dir, tt.expected)
+		}
+	}
+}
+
+func TestIsRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test paths are POSIX")
+	}
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/", true},
+		{"//", true},
+		{"/tmp/..", true},
+		{"/tmp", false},
+		{"/tmp/", false},
+	}
+	for _, tt := range tests {
+		if isRoot(tt.path) != tt.expected {
+			t.Errorf("isRoot(%q): expected %v", tt.path, tt.expected)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	flags, args, err := parseFlags([]string{"-rf", "-R", "--", "-p", "x"}, "rRf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !flags['r'] || !flags['f'] || !flags['R'] || len(args) != 2 || args[0] != "-p" {
+		t.Errorf("unexpected result: %v %v", flags, args)
+	}
+	if _, _, err := parseFlags([]string{"-i", "x"}, "rRf"); err != errFallback {
+		t.Errorf("expected fallback, got %v", err)
+	}
+}
+
+func TestBuiltinWait(t *testing.T) {
+	dir := t.TempDir()
+	estate, _ := runBuiltinTest(t, dir, "wait-for-file -t 200ms nonexistent", nil)
+	if estate.Error == nil || estate.ErrOutput == "" {
+		t.Errorf("expected timeout error")
+	}
+	estate, _ = runBuiltinTest(t, dir, "touch exists && wait-for-file exists", nil)
+	if estate.Error != nil {
+		t.Errorf("unexpected error: %s", estate.Error)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	estate, _ = runBuiltinTest(t, dir, "wait-for-port -t 5s "+addr, nil)
+	if estate.Error != nil {
+		t.Errorf("unexpected error: %s", estate.Error)
+	}
+	l.Close()
+	estate, _ = runBuiltinTest(t, dir, "wait-for-port -t 200ms "+addr, nil)
+	if estate.Error == nil {
+		t.Errorf("expected timeout error")
+	}
+	estate, _ = runBuiltinTest(t, dir, "wait-for-port nocolon", nil)
+	if estate.Error == nil {
+		t.Errorf("expected error for invalid address")
+	}
+}
+
+func TestBuiltinNotify(t *testing.T) {
+	var title, body string
+	notify := func(t string, b string) {
+		title, body = t, b
+	}
+	estate, _ := runBuiltinTest(t, "", "notify 'build done' \"all good\"", notify)
+	if estate.Error != nil {
+		t.Fatalf("unexpected error: %s", estate.Error)
+	}
+	if title != "build done" || body != "all good" {
+		t.Errorf("unexpected notification: %q %q", title, body)
+	}
+	estate, _ = runBuiltinTest(t, "", "notify title body", nil)
+	if estate.Error == nil {
+		t.Error("expected error without a notifier")
+	}
+}
@@ -0,0 +1,39 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// splitCommand tokenizes a command for the exec shell, which runs programs
+// directly rather than through a shell. Quoting and variable expansion follow
+// POSIX shell rules, but the command must be a single simple command - pipes,
+// redirects, command lists and command substitution are not supported.
+func splitCommand(command string) ([]string, error) {
+	prog, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, fmt.Errorf("exec: %s", err)
+	}
+	if len(prog.Stmts) != 1 {
+		return nil, fmt.Errorf("exec: expected a single command: %q", command)
+	}
+	stmt := prog.Stmts[0]
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || stmt.Negated || stmt.Background || len(stmt.Redirs) > 0 ||
+		len(call.Assigns) > 0 || len(call.Args) == 0 {
+		return nil, fmt.Errorf("exec: expected a simple command: %q", command)
+	}
+	cfg := &expand.Config{Env: expand.ListEnviron(os.Environ()...)}
+	args, err := expand.Fields(cfg, call.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec: %s", err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("exec: empty command: %q", command)
+	}
+	return args, nil
+}
@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var splitCommandTests = []struct {
+	command string
+	args    []string
+}{
+	{"ls", []string{"ls"}},
+	{"ls -l  foo", []string{"ls", "-l", "foo"}},
+	{`echo "a b" 'c d' e\ f`, []string{"echo", "a b", "c d", "e f"}},
+	{"echo $MODD_SPLIT_TEST", []string{"echo", "foo", "bar"}},
+	{`echo "$MODD_SPLIT_TEST"`, []string{"echo", "foo bar"}},
+	{"echo \\\n  foo", []string{"echo", "foo"}},
+}
+
+var splitCommandErrors = []string{
+	"",
+	"ls; ls",
+	"ls | wc",
+	"ls > foo",
+	"ls &",
+	"! ls",
+	"FOO=bar ls",
+	"echo $(ls)",
+	"if true; then ls; fi",
+	"echo 'unterminated",
+}
+
+func TestSplitCommand(t *testing.T) {
+	os.Setenv("MODD_SPLIT_TEST", "foo bar")
+	defer os.Unsetenv("MODD_SPLIT_TEST")
+	for _, tt := range splitCommandTests {
+		args, err := splitCommand(tt.command)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.command, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.args, args); diff != "" {
+			t.Errorf("%q: %s", tt.command, diff)
+		}
+	}
+	for _, command := range splitCommandErrors {
+		if _, err := splitCommand(command); err == nil {
+			t.Errorf("%q: expected error", command)
+		}
+	}
+}
+
+func TestExecShell(t *testing.T) {
+	tests := []cmdTest{
+		{
+			name:   "echo",
+			cmd:    "echo moddtest",
+			logHas: "moddtest",
+		},
+		{
+			name:    "stderr",
+			cmd:     "ls /definitely/no/such/path/moddtest",
+			bufferr: true,
+			buffHas: "moddtest",
+			procerr: true,
+		},
+		{
+			name:     "timeout",
+			cmd:      "sh -c 'echo moddtest; sleep 999999'",
+			logHas:   "moddtest",
+			timeout:  500 * time.Millisecond,
+			procerr:  true,
+			timedout: true,
+		},
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test commands are POSIX")
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) { testCmd(t, "exec", tc) })
+	}
+}
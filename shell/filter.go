@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"regexp"
+
+	"github.com/cortesi/termlog"
+	"github.com/fatih/color"
+)
+
+// heldOutputLimit is the maximum number of bytes of output held back by a
+// quiet executor. Older lines are discarded once it's reached.
+const heldOutputLimit = 256 * 1024
+
+// highlightColor is the style of lines matching an executor's Highlight
+// patterns. It's distinct from the log level colors, so highlighted lines
+// aren't mistaken for errors from modd itself.
+var highlightColor = color.New(color.Bold, color.ReverseVideo)
+
+// heldLine is a line of output held back from the terminal by Executor.Quiet
+type heldLine struct {
+	out  func(string, ...interface{})
+	line string
+}
+
+func matchAny(patterns []*regexp.Regexp, line string) bool {
+	for _, p := range patterns {
+		if p.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// show displays a line of output in the terminal using out, applying the
+// executor's output rules. Dropped lines are discarded, highlighted lines are
+// shown in highlightColor, and if the executor is quiet, lines are held in buff
+// until release is called.
+func (e *Executor) show(
+	log termlog.Stream, out func(string, ...interface{}), buff *outputBuffers, line string,
+) {
+	if matchAny(e.Drop, line) {
+		return
+	}
+	if matchAny(e.Highlight, line) {
+		line = highlightColor.Sprint(line)
+	}
+	if e.Quiet {
+		buff.hold(heldLine{out, line})
+		return
+	}
+	out("%s", line)
+}
+
+// hold keeps a line of output back, discarding the oldest held lines if we're
+// over heldOutputLimit
+func (buff *outputBuffers) hold(l heldLine) {
+	buff.Lock()
+	defer buff.Unlock()
+	buff.held = append(buff.held, l)
+	buff.heldSize += len(l.line)
+	for buff.heldSize > heldOutputLimit && len(buff.held) > 1 {
+		buff.heldSize -= len(buff.held[0].line)
+		buff.held = buff.held[1:]
+		buff.omitted++
+	}
+}
+
+// release displays the output held back by a quiet executor if the command
+// failed, and discards it otherwise.
+func (buff *outputBuffers) release(log termlog.Stream, failed bool) {
+	buff.Lock()
+	defer buff.Unlock()
+	if failed {
+		if buff.omitted > 0 {
+			log.Warn("... %d earlier lines of output omitted", buff.omitted)
+		}
+		for _, l := range buff.held {
+			l.out("%s", l.line)
+		}
+	}
+	buff.held = nil
+	buff.heldSize = 0
+	buff.omitted = 0
+}
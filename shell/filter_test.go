@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+// recordStream records the lines logged at each level
+type recordStream struct {
+	termlog.Stream
+	said    []string
+	shouted []string
+}
+
+func (s *recordStream) Say(format string, args ...interface{}) {
+	s.said = append(s.said, fmt.Sprintf(format, args...))
+	s.Stream.Say(format, args...)
+}
+
+func (s *recordStream) Shout(format string, args ...interface{}) {
+	s.shouted = append(s.shouted, fmt.Sprintf(format, args...))
+	s.Stream.Shout(format, args...)
+}
+
+func TestOutputRules(t *testing.T) {
+	highlightColor.EnableColor()
+	defer highlightColor.DisableColor()
+	run := func(ex *Executor, cmd string) (string, *recordStream) {
+		ex.Shell = "modd"
+		ex.Command = cmd
+		ex.InProcess = true
+		lt := termlog.NewLogTest()
+		log := &recordStream{Stream: lt.Log.Stream("")}
+		err, _ := ex.Run(log, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lt.String(), log
+	}
+	cmd := "echo 'GET /health'; echo 'ERROR: oops'; echo done"
+
+	out, log := run(&Executor{
+		Drop:      []*regexp.Regexp{regexp.MustCompile("^GET")},
+		Highlight: []*regexp.Regexp{regexp.MustCompile("ERROR")},
+	}, cmd)
+	if strings.Contains(out, "GET") || !strings.Contains(out, "done") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	expected := []string{highlightColor.Sprint("ERROR: oops"), "done"}
+	if !reflect.DeepEqual(log.said, expected) {
+		t.Errorf("expected %q, got %q", expected, log.said)
+	}
+	if len(log.shouted) != 0 {
+		t.Errorf("highlighted lines shown as errors: %q", log.shouted)
+	}
+
+	out, _ = run(&Executor{Quiet: true}, cmd)
+	if out != "" {
+		t.Errorf("expected no output from quiet success, got %q", out)
+	}
+	out, _ = run(&Executor{Quiet: true}, cmd+"; exit 1")
+	if !strings.Contains(out, "ERROR: oops") || !strings.Contains(out, "done") {
+		t.Errorf("expected output from quiet failure, got %q", out)
+	}
+}
+
+func TestHeldOutputLimit(t *testing.T) {
+	lt := termlog.NewLogTest()
+	log := &recordStream{Stream: lt.Log.Stream("")}
+	buff := &outputBuffers{}
+	line := strings.Repeat("x", 1023)
+	for i := 0; i < 1000; i++ {
+		buff.hold(heldLine{log.Say, line})
+	}
+	if buff.heldSize > heldOutputLimit {
+		t.Errorf("held %d bytes, over the limit", buff.heldSize)
+	}
+	buff.release(log, true)
+	if len(log.said) != 256 || buff.omitted != 0 {
+		t.Errorf("expected 256 lines, got %d", len(log.said))
+	}
+	if !strings.Contains(lt.String(), "744 earlier lines of output omitted") {
+		t.Errorf("expected omitted lines to be noted, got %q", Tail(lt.String(), 200))
+	}
+}
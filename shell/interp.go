@@ -0,0 +1,264 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/termlog"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// ExitError reports that a command run in-process by the built-in shell exited
+// with a non-zero status.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit status of the command
+func (e ExitError) ExitCode() int {
+	return e.Code
+}
+
+// newRunner creates an interpreter for the built-in shell, with modd's
+// builtin commands. External commands are run by the handlers passed in, or
+// by the interpreter's default handler if there are none. Each runner gets
+// its own copy of the environment, so changes made by one command are not
+// seen by others. The notify builtin calls notify, which may be nil.
+func newRunner(
+	dir string, stdin io.Reader, stdout, stderr io.Writer, notify NotifyFunc,
+	handlers ...func(interp.ExecHandlerFunc) interp.ExecHandlerFunc,
+) (*interp.Runner, error) {
+	b := &builtins{notify: notify}
+	handlers = append([]func(interp.ExecHandlerFunc) interp.ExecHandlerFunc{b.handler}, handlers...)
+	opts := []interp.RunnerOption{
+		interp.StdIO(stdin, stdout, stderr),
+		interp.Env(expand.ListEnviron(os.Environ()...)),
+		interp.ExecHandlers(handlers...),
+	}
+	if dir != "" {
+		opts = append(opts, interp.Dir(dir))
+	}
+	return interp.New(opts...)
+}
+
+// RunBuiltin runs a command using the built-in shell. If the command exits
+// with a non-zero status, the returned error is an ExitError.
+func RunBuiltin(
+	ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer,
+) error {
+	prog, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return err
+	}
+	runner, err := newRunner("", stdin, stdout, stderr, nil)
+	if err != nil {
+		return err
+	}
+	return exitError(runner.Run(ctx, prog))
+}
+
+// exitError converts exit statuses returned by the interpreter to ExitErrors
+func exitError(err error) error {
+	if status, ok := interp.IsExitStatus(err); ok {
+		if status == 0 {
+			return nil
+		}
+		return ExitError{Code: int(status)}
+	}
+	return err
+}
+
+// inProcess returns true if the executor runs its command in-process
+func (e *Executor) inProcess() bool {
+	return e.InProcess && e.Shell == "modd" && !e.Pty && e.Stdin == nil
+}
+
+// runInProcess runs the command with the built-in shell interpreter, without
+// starting a new modd process. The command is stopped when ctx is done, and
+// cancel is used to stop it from Signal and Terminate.
+func (e *Executor) runInProcess(
+	ctx context.Context, cancel context.CancelFunc, log termlog.Stream, bufferr bool,
+) (error, *ExecState) {
+	start := time.Now()
+	e.Lock()
+	if e.running() {
+		e.Unlock()
+		return fmt.Errorf("already running"), nil
+	}
+	e.cancel = cancel
+	e.Unlock()
+	defer e.reset()
+
+	buff := e.newOutputBuffers()
+	stdout, stderr := e.outputFuncs(log, bufferr, buff)
+	ow := &lineWriter{out: stdout}
+	ew := &lineWriter{out: stderr}
+
+	if e.LogFile != nil {
+		e.LogFile.Printf("--- started: %s", e.Command)
+	}
+	ext := &externals{ex: e}
+	prog, err := syntax.NewParser().Parse(strings.NewReader(e.Command), "")
+	if err == nil {
+		var runner *interp.Runner
+		runner, err = newRunner(e.Dir, nil, ow, ew, e.Notify, ext.handler)
+		if err != nil {
+			return err, nil
+		}
+		err = exitError(runner.Run(ctx, prog))
+	} else {
+		ew.Write([]byte(err.Error() + "\n"))
+	}
+	ow.Flush()
+	ew.Flush()
+
+	estate := &ExecState{
+		Error:     err,
+		ErrOutput: buff.stderr.String(),
+		Output:    buff.combined.String(),
+		ProcState: "exit status 0",
+		ExitInfo:  ext.exitInfo(time.Since(start)),
+	}
+	var ee ExitError
+	if ctx.Err() != nil {
+		estate.Error = &CancelledError{Err: ctx.Err()}
+		estate.ProcState = "killed"
+		estate.ExitCode = -1
+	} else if errors.As(err, &ee) {
+		estate.ProcState = ee.Error()
+		estate.ExitCode = ee.Code
+	} else if err != nil {
+		estate.ProcState = "exit status 1"
+		estate.ExitCode = 1
+	}
+	buff.release(log, estate.Error != nil)
+	if e.LogFile != nil {
+		e.LogFile.Printf("--- exited: %s", estate.ProcState)
+	}
+	return nil, estate
+}
+
+// externals runs external commands for the built-in shell, and adds up their
+// resource usage
+type externals struct {
+	ex     *Executor
+	user   time.Duration
+	sys    time.Duration
+	maxRSS int64
+	sync.Mutex
+}
+
+// handler is an interp exec handler middleware that runs external commands.
+// Like any other command, each one is started in its own process group, which
+// is stopped with stopOnCancel when ctx is done. This means that background
+// processes they start are stopped too.
+func (x *externals) handler(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+		if err != nil {
+			fmt.Fprintln(hc.Stderr, err)
+			return interp.NewExitStatus(127)
+		}
+		env := []string{}
+		for name, vr := range hc.Env.Each {
+			if vr.IsSet() && vr.Exported && vr.Kind == expand.String {
+				env = append(env, name+"="+vr.String())
+			}
+		}
+		cmd := &exec.Cmd{
+			Path:   path,
+			Args:   args,
+			Env:    env,
+			Dir:    hc.Dir,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+		prepCmd(cmd)
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintln(hc.Stderr, err)
+			return interp.NewExitStatus(127)
+		}
+		exited := make(chan struct{})
+		go x.ex.stopOnCancel(ctx, cmd, exited)
+		err = cmd.Wait()
+		close(exited)
+		if cmd.ProcessState != nil {
+			x.add(cmd.ProcessState)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return interp.NewExitStatus(uint8(procExitStatus(ee.ProcessState)))
+		}
+		return err
+	}
+}
+
+func (x *externals) add(ps *os.ProcessState) {
+	x.Lock()
+	defer x.Unlock()
+	x.user += ps.UserTime()
+	x.sys += ps.SystemTime()
+	if rss := procMaxRSS(ps); rss > x.maxRSS {
+		x.maxRSS = rss
+	}
+}
+
+// exitInfo returns the resource usage as an ExitInfo. CPU times are the totals
+// for all commands, and the maximum resident set size is that of the largest.
+func (x *externals) exitInfo(wall time.Duration) ExitInfo {
+	x.Lock()
+	defer x.Unlock()
+	return ExitInfo{WallTime: wall, UserTime: x.user, SysTime: x.sys, MaxRSS: x.maxRSS}
+}
+
+// lineWriter is a writer that passes each complete line written to it to an
+// output function.
+type lineWriter struct {
+	out func(string, ...interface{})
+	buf []byte
+	sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.out("%s", strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush outputs any partial line that remains in the buffer
+func (w *lineWriter) Flush() {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.buf) > 0 {
+		w.out("%s", string(w.buf))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestInProcess(t *testing.T) {
+	for _, tc := range shellTests {
+		if tc.shells != nil && !strings.Contains(strings.Join(tc.shells, " "), "modd") {
+			continue
+		}
+		tc.inprocess = true
+		t.Run(tc.name, func(t *testing.T) { testCmd(t, "modd", tc) })
+	}
+}
+
+func TestInProcessIsolation(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(cmd string) string {
+		lt := termlog.NewLogTest()
+		ex, err := NewExecutor("modd", cmd, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex.InProcess = true
+		err, estate := ex.Run(lt.Log.Stream(""), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estate.Error != nil {
+			t.Fatalf("unexpected error: %s", estate.Error)
+		}
+		return lt.String()
+	}
+	run("export MODD_ISOLATION_TEST=foo; cd ..")
+	if out := run("echo x${MODD_ISOLATION_TEST}x"); !strings.Contains(out, "xx") {
+		t.Errorf("environment leaked between commands: %s", out)
+	}
+	if os.Getenv("MODD_ISOLATION_TEST") != "" {
+		t.Error("environment leaked into modd")
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("working directory changed to %s", now)
+	}
+}
+
+func TestInProcessExitCode(t *testing.T) {
+	lt := termlog.NewLogTest()
+	ex, err := NewExecutor("modd", "exit 3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.InProcess = true
+	err, estate := ex.Run(lt.Log.Stream(""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ee, ok := estate.Error.(ExitError); !ok || ee.Code != 3 {
+		t.Errorf("unexpected error: %#v", estate.Error)
+	}
+	if estate.ProcState != "exit status 3" {
+		t.Errorf("unexpected process state: %s", estate.ProcState)
+	}
+}
+
+func TestInProcessTimeoutBackground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test commands are POSIX")
+	}
+	lt := termlog.NewLogTest()
+	ex, err := NewExecutor("modd", "sh -c 'sleep 20 & sleep 20'", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.InProcess = true
+	ex.Timeout = 500 * time.Millisecond
+	start := time.Now()
+	err, estate := ex.Run(lt.Log.Stream(""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("command took %s to stop", d)
+	}
+	if !estate.TimedOut {
+		t.Errorf("expected timeout, got %v", estate.Error)
+	}
+}
+
+func TestInProcessExitInfo(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping - max rss is only checked on Linux")
+	}
+	lt := termlog.NewLogTest()
+	ex, err := NewExecutor("modd", "sh -c true && sh -c true", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.InProcess = true
+	err, estate := ex.Run(lt.Log.Stream(""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estate.WallTime <= 0 || estate.MaxRSS <= 0 {
+		t.Errorf("expected usage of external commands, got %#v", estate.ExitInfo)
+	}
+}
@@ -0,0 +1,128 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MaxLogSize is the size at which log files are rotated
+var MaxLogSize int64 = 10 * 1024 * 1024
+
+// MaxLogBackups is the number of rotated log files we keep
+var MaxLogBackups = 3
+
+const logTimeFmt = "2006-01-02 15:04:05.000"
+
+// A LogFile is a rotating log file that process output can be teed to. Each
+// line is prefixed with a timestamp.
+type LogFile struct {
+	Path string
+
+	f    *os.File
+	size int64
+	// The number of times the file has been opened and not yet closed.
+	// Protected by logFilesLock.
+	refs int
+	sync.Mutex
+}
+
+var logFiles = map[string]*LogFile{}
+var logFilesLock sync.Mutex
+
+// OpenLogFile returns the LogFile for a path, opening it if needed. Log files
+// are shared between all commands that log to the same path, and each call
+// must be matched by a call to Close.
+func OpenLogFile(path string) (*LogFile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+	if lf, ok := logFiles[path]; ok {
+		lf.refs++
+		return lf, nil
+	}
+	lf := &LogFile{Path: path, refs: 1}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	logFiles[path] = lf
+	return lf, nil
+}
+
+// Close releases the log file. The file is closed once every command that
+// opened it has closed it.
+func (lf *LogFile) Close() error {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+	lf.refs--
+	if lf.refs > 0 {
+		return nil
+	}
+	delete(logFiles, lf.Path)
+	lf.Lock()
+	defer lf.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+func (lf *LogFile) open() error {
+	err := os.MkdirAll(filepath.Dir(lf.Path), 0777)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(lf.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = fi.Size()
+	return nil
+}
+
+// rotate moves the current log file to Path.1, shifting older backups along
+// and removing the oldest, and then opens a fresh file.
+func (lf *LogFile) rotate() error {
+	lf.f.Close()
+	for i := MaxLogBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", lf.Path, i), fmt.Sprintf("%s.%d", lf.Path, i+1))
+	}
+	if MaxLogBackups > 0 {
+		os.Rename(lf.Path, lf.Path+".1")
+	} else {
+		os.Remove(lf.Path)
+	}
+	return lf.open()
+}
+
+// Printf writes a timestamped line to the log file. Errors are ignored, since
+// there's nowhere sensible to report them.
+func (lf *LogFile) Printf(format string, args ...interface{}) {
+	lf.Lock()
+	defer lf.Unlock()
+	if lf.f == nil {
+		return
+	}
+	if lf.size >= MaxLogSize {
+		if err := lf.rotate(); err != nil {
+			lf.f = nil
+			return
+		}
+	}
+	line := time.Now().Format(logTimeFmt) + " " + fmt.Sprintf(format, args...) + "\n"
+	n, _ := lf.f.WriteString(line)
+	lf.size += int64(n)
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/modd/utils"
+)
+
+func TestLogFile(t *testing.T) {
+	defer utils.WithTempDir(t)()
+	oldSize, oldBackups := MaxLogSize, MaxLogBackups
+	defer func() {
+		MaxLogSize, MaxLogBackups = oldSize, oldBackups
+	}()
+	MaxLogSize = 100
+	MaxLogBackups = 2
+
+	lf, err := OpenLogFile("logs/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf2, _ := OpenLogFile("logs/test.log")
+	if lf2 != lf {
+		t.Errorf("Expected log files to be shared")
+	}
+	lf2.Close()
+	for i := 0; i < 20; i++ {
+		lf.Printf("line %d", i)
+	}
+	for _, p := range []string{"logs/test.log", "logs/test.log.1", "logs/test.log.2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Expected %s to exist: %s", p, err)
+		}
+	}
+	if _, err := os.Stat("logs/test.log.3"); err == nil {
+		t.Errorf("Expected only %d backups", MaxLogBackups)
+	}
+	data, err := os.ReadFile("logs/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), " line 19\n") {
+		t.Errorf("Unexpected log contents: %q", data)
+	}
+
+	lf.Close()
+	if lf.f != nil {
+		t.Error("Expected the file to be closed")
+	}
+	lf.Printf("after close")
+	if lf3, _ := OpenLogFile("logs/test.log"); lf3 == lf {
+		t.Error("Expected a closed log file to be reopened")
+	} else {
+		lf3.Close()
+	}
+}
@@ -6,6 +6,7 @@ package shell
 import (
 	"os"
 	"os/exec"
+	"runtime"
 	"syscall"
 )
 
@@ -13,6 +14,39 @@ func prepCmd(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
-func (e *Executor) sendSignal(sig os.Signal) error {
-	return syscall.Kill(-e.cmd.Process.Pid, sig.(syscall.Signal))
+// signalProcess sends a signal to a command's process group
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+// procSignal returns the name of the signal that terminated a process, or an
+// empty string if it exited normally.
+func procSignal(ps *os.ProcessState) string {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal().String()
+	}
+	return ""
+}
+
+// procExitStatus returns a process's exit status as a shell would report it,
+// with 128 added to the number of the signal that terminated it.
+func procExitStatus(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+// procMaxRSS returns the maximum resident set size of a process in bytes, or 0
+// if it's not known.
+func procMaxRSS(ps *os.ProcessState) int64 {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Linux and the BSDs report kilobytes, macOS reports bytes
+	if runtime.GOOS == "darwin" {
+		return int64(ru.Maxrss)
+	}
+	return int64(ru.Maxrss) * 1024
 }
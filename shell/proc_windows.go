@@ -17,6 +17,25 @@ func prepCmd(cmd *exec.Cmd) {
 	}
 }
 
-func (e *Executor) sendSignal(sig os.Signal) error {
-	return exec.Command("taskkill", "/f", "/t", "/pid", strconv.Itoa(e.cmd.Process.Pid)).Run()
+// signalProcess stops a command's process tree. Windows doesn't support
+// signals, so the signal is ignored.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	return exec.Command("taskkill", "/f", "/t", "/pid", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// procSignal returns the name of the signal that terminated a process. Windows
+// processes aren't terminated by signals, so this is always empty.
+func procSignal(ps *os.ProcessState) string {
+	return ""
+}
+
+// procExitStatus returns a process's exit status as a shell would report it
+func procExitStatus(ps *os.ProcessState) int {
+	return ps.ExitCode()
+}
+
+// procMaxRSS returns the maximum resident set size of a process in bytes. This
+// isn't available on Windows, so we always return 0.
+func procMaxRSS(ps *os.ProcessState) int64 {
+	return 0
 }
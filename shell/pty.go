@@ -0,0 +1,40 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+var errNoPty = errors.New("pseudo-terminals are not supported on this platform")
+
+// ptyPipes attaches separate pseudo-terminals to a command's stdout and
+// stderr, so that the command believes it's writing to a terminal. It returns
+// the master ends, from which output can be read, and the slave ends, which
+// must be closed once the command has started.
+func ptyPipes(cmd *exec.Cmd) ([]io.ReadCloser, []*os.File, error) {
+	masters := []io.ReadCloser{}
+	slaves := []*os.File{}
+	cleanup := func() {
+		for _, m := range masters {
+			m.Close()
+		}
+		for _, s := range slaves {
+			s.Close()
+		}
+	}
+	for i := 0; i < 2; i++ {
+		master, slave, err := openPtyPair()
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		setPtySize(master)
+		masters = append(masters, master)
+		slaves = append(slaves, slave)
+	}
+	cmd.Stdout = slaves[0]
+	cmd.Stderr = slaves[1]
+	return masters, slaves, nil
+}
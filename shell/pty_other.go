@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package shell
+
+import (
+	"os"
+)
+
+// openPtyPair is not supported on this platform
+func openPtyPair() (*os.File, *os.File, error) {
+	return nil, nil, errNoPty
+}
+
+func setPtySize(master *os.File) {}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package shell
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// setPtySize sets the size of a pseudo-terminal to match our own terminal,
+// falling back to 80x24 if we're not attached to one.
+func setPtySize(master *os.File) {
+	ws := &unix.Winsize{Col: 80, Row: 24}
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		ws.Col = uint16(w)
+		ws.Row = uint16(h)
+	}
+	unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, ws)
+}
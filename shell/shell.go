@@ -3,41 +3,138 @@ package shell
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cortesi/termlog"
 )
 
 var ValidShells = map[string]bool{
 	"bash":       true,
+	"exec":       true,
+	"fish":       true,
 	"modd":       true,
 	"powershell": true,
 	"sh":         true,
+	"zsh":        true,
 }
 
 var shellTesting bool
 
 var Default = "modd"
 
+// KillGrace is the default time we give a process to exit after asking it to
+// terminate, before we kill it outright.
+var KillGrace = 5 * time.Second
+
 type Executor struct {
 	Shell   string
 	Command string
 	Dir     string
+	// If Timeout is non-zero, the process is terminated if it runs for longer
+	// than the specified duration.
+	Timeout time.Duration
+	// If LogFile is not nil, output is also written to the log file
+	LogFile *LogFile
+	// If Pty is true, the process is run with its output attached to
+	// pseudo-terminals, so that it behaves as if it's running in a terminal.
+	// Where pseudo-terminals are unavailable, we fall back to pipes.
+	Pty bool
+	// If Stdin is not nil, the process's stdin is attached to the relay while
+	// it runs
+	Stdin *StdinRelay
+	// If InProcess is true, commands for the built-in modd shell are
+	// interpreted in-process rather than by a new modd process. Commands that
+	// need a pseudo-terminal or stdin still run in a separate process.
+	InProcess bool
+	// Notify is called by the notify builtin in in-process commands
+	Notify NotifyFunc
+
+	// CancelSignal is sent to the process group to stop the command when it's
+	// cancelled or times out. If nil, SIGTERM is used.
+	CancelSignal os.Signal
+	// Grace is the time we give the process to exit after sending
+	// CancelSignal, before killing it. If zero, KillGrace is used.
+	Grace time.Duration
+	// Lines of output matching any of the Drop patterns are not shown
+	Drop []*regexp.Regexp
+	// Lines of output matching any of the Highlight patterns are shown in the
+	// highlight colour
+	Highlight []*regexp.Regexp
+	// If Quiet is true, output is only shown if the command fails
+	Quiet bool
+	// OutputLimit is the maximum number of bytes of combined output kept in
+	// ExecState.Output. If zero, DefaultOutputLimit is used.
+	OutputLimit int
 
-	cmd  *exec.Cmd
-	stdo io.ReadCloser
-	stde io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc // Cancels the running command
+	stdi   io.WriteCloser
+	stdo   io.ReadCloser
+	stde   io.ReadCloser
 	sync.Mutex
 }
 
+// CancelledError is the error reported in ExecState when a command was stopped
+// because its context was cancelled, or because it timed out.
+type CancelledError struct {
+	// The context error - context.Canceled or context.DeadlineExceeded
+	Err error
+}
+
+func (e *CancelledError) Error() string {
+	return "cancelled: " + e.Err.Error()
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
 type ExecState struct {
 	Error     error
 	ErrOutput string
+	// The most recent output on stdout and stderr, interleaved, if output
+	// was buffered
+	Output    string
 	ProcState string
+	TimedOut  bool
+	ExitInfo
+}
+
+// ExitInfo describes how a process exited, and the resources it used. Resource
+// usage is zero where it's not available - for instance, for commands run
+// in-process, or for max RSS on Windows.
+type ExitInfo struct {
+	// The exit code, or -1 if the process was terminated by a signal or
+	// cancelled
+	ExitCode int
+	// The name of the signal that terminated the process, if any
+	Signal   string
+	WallTime time.Duration
+	UserTime time.Duration
+	SysTime  time.Duration
+	// Maximum resident set size in bytes
+	MaxRSS int64
+}
+
+// newExitInfo extracts exit information from a process state
+func newExitInfo(ps *os.ProcessState, wall time.Duration) ExitInfo {
+	return ExitInfo{
+		ExitCode: ps.ExitCode(),
+		Signal:   procSignal(ps),
+		WallTime: wall,
+		UserTime: ps.UserTime(),
+		SysTime:  ps.SystemTime(),
+		MaxRSS:   procMaxRSS(ps),
+	}
 }
 
 func GetShellName(v string) (string, error) {
@@ -63,53 +160,127 @@ func NewExecutor(shell string, command string, dir string) (*Executor, error) {
 }
 
 func (e *Executor) start(
-	log termlog.Stream, bufferr bool,
-) (*exec.Cmd, *bytes.Buffer, *sync.WaitGroup, error) {
+	log termlog.Stream, bufferr bool, cancel context.CancelFunc,
+) (*exec.Cmd, *outputBuffers, *sync.WaitGroup, error) {
 	e.Lock()
 	defer e.Unlock()
+	if e.running() {
+		return nil, nil, nil, fmt.Errorf("already running")
+	}
 
 	cmd, err := makeCommand(e.Shell, e.Command, e.Dir)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	e.cmd = cmd
 
-	stdo, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, nil, nil, err
+	var stdo, stde io.ReadCloser
+	var slaves []*os.File
+	if e.Pty {
+		masters, s, err := ptyPipes(cmd)
+		if err != nil {
+			log.Warn("could not open pseudo-terminal, using pipes: %s", err)
+		} else {
+			stdo, stde, slaves = masters[0], masters[1], s
+		}
 	}
-	stde, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, nil, nil, err
+	if stdo == nil {
+		stdo, err = cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		stde, err = cmd.StderrPipe()
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
 	e.stdo = stdo
 	e.stde = stde
+	e.stdi = nil
+	if e.Stdin != nil {
+		e.stdi, err = cmd.StdinPipe()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
-	buff := new(bytes.Buffer)
+	buff := e.newOutputBuffers()
 	err = cmd.Start()
+	// The child has its own copies of the pseudo-terminal slaves. We must close
+	// ours, so that reads from the masters end when the child exits.
+	for _, s := range slaves {
+		s.Close()
+	}
 	if err != nil {
+		if slaves != nil {
+			stdo.Close()
+			stde.Close()
+		}
 		return nil, nil, nil, err
 	}
+	e.cmd = cmd
+	e.cancel = cancel
+	if e.stdi != nil {
+		e.Stdin.Attach(e.stdi)
+	}
 	wg := sync.WaitGroup{}
 	wg.Add(2)
-	buflock := sync.Mutex{}
-	go logOutput(
-		&wg, stde,
-		func(s string, args ...interface{}) {
-			log.Warn(s, args...)
-			if bufferr {
-				buflock.Lock()
-				defer buflock.Unlock()
-				fmt.Fprintf(buff, "%s\n", args...)
-			}
-		},
-	)
-	go logOutput(&wg, stdo, log.Say)
+	if e.LogFile != nil {
+		e.LogFile.Printf("--- started: %s", e.Command)
+	}
+	stdout, stderr := e.outputFuncs(log, bufferr, buff)
+	go logOutput(&wg, stde, stderr)
+	go logOutput(&wg, stdo, stdout)
 	return cmd, buff, &wg, nil
 }
 
+// outputBuffers hold the buffered output of a command
+type outputBuffers struct {
+	stderr   bytes.Buffer
+	combined *tailBuffer
+	held     []heldLine
+	heldSize int
+	omitted  int
+	sync.Mutex
+}
+
+func (e *Executor) newOutputBuffers() *outputBuffers {
+	return &outputBuffers{combined: newTailBuffer(e.OutputLimit)}
+}
+
+// outputFuncs returns functions that handle lines of output from the command.
+// Output goes to log, subject to the executor's output rules, and to the log
+// file, if any. If bufferr is true, output is also written to buff.
+func (e *Executor) outputFuncs(
+	log termlog.Stream, bufferr bool, buff *outputBuffers,
+) (func(string, ...interface{}), func(string, ...interface{})) {
+	stdout := func(s string, args ...interface{}) {
+		line := fmt.Sprintf(s, args...)
+		e.show(log, log.Say, buff, line)
+		if e.LogFile != nil {
+			e.LogFile.Printf("%s", line)
+		}
+		if bufferr {
+			buff.combined.add(line)
+		}
+	}
+	stderr := func(s string, args ...interface{}) {
+		line := fmt.Sprintf(s, args...)
+		e.show(log, log.Warn, buff, line)
+		if e.LogFile != nil {
+			e.LogFile.Printf("stderr: %s", line)
+		}
+		if bufferr {
+			buff.combined.add(line)
+			buff.Lock()
+			defer buff.Unlock()
+			buff.stderr.WriteString(line + "\n")
+		}
+	}
+	return stdout, stderr
+}
+
 func (e *Executor) running() bool {
-	return e.cmd != nil
+	return e.cmd != nil || e.cancel != nil
 }
 
 func (e *Executor) Running() bool {
@@ -122,53 +293,156 @@ func (e *Executor) reset() {
 	e.Lock()
 	defer e.Unlock()
 	e.cmd = nil
+	e.cancel = nil
 }
 
+// Run runs the command to completion. It's equivalent to RunContext with a
+// context that is never cancelled.
 func (e *Executor) Run(log termlog.Stream, bufferr bool) (error, *ExecState) {
-	if e.cmd != nil {
-		return fmt.Errorf("already running"), nil
+	return e.RunContext(context.Background(), log, bufferr)
+}
+
+// RunContext runs the command to completion. If ctx is cancelled or the
+// executor's timeout expires, the process group is sent CancelSignal, and is
+// killed if it's still running after the grace period. The Error in the
+// returned ExecState is then a *CancelledError.
+func (e *Executor) RunContext(
+	ctx context.Context, log termlog.Stream, bufferr bool,
+) (error, *ExecState) {
+	runCtx, cancel := context.WithCancel(ctx)
+	if e.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+	}
+	defer cancel()
+	// We only report a timeout if the deadline was ours, not the caller's
+	timedOut := func() bool {
+		return e.Timeout > 0 && ctx.Err() == nil &&
+			runCtx.Err() == context.DeadlineExceeded
+	}
+
+	if err := runCtx.Err(); err != nil {
+		return nil, &ExecState{
+			Error:     &CancelledError{Err: err},
+			ProcState: "not started",
+			TimedOut:  timedOut(),
+			ExitInfo:  ExitInfo{ExitCode: -1},
+		}
 	}
-	cmd, buff, wg, err := e.start(log, bufferr)
+	if e.inProcess() {
+		err, estate := e.runInProcess(runCtx, cancel, log, bufferr)
+		if estate != nil {
+			estate.TimedOut = timedOut()
+		}
+		return err, estate
+	}
+
+	start := time.Now()
+	cmd, buff, wg, err := e.start(log, bufferr, cancel)
 	if err != nil {
 		return err, nil
 	}
+	defer e.reset()
+	exited := make(chan struct{})
+	go e.stopOnCancel(runCtx, cmd, exited)
 
 	// Order is important here. We MUST wait for the readers to exit before we wait
 	// on the command itself.
 	wg.Wait()
 
 	eret := cmd.Wait()
+	close(exited)
+	if e.stdi != nil {
+		e.Stdin.Detach(e.stdi)
+	}
+	if err := runCtx.Err(); err != nil {
+		eret = &CancelledError{Err: err}
+	}
 	estate := &ExecState{
 		Error:     eret,
-		ErrOutput: buff.String(),
+		ErrOutput: buff.stderr.String(),
+		Output:    buff.combined.String(),
 		ProcState: cmd.ProcessState.String(),
+		TimedOut:  timedOut(),
+		ExitInfo:  newExitInfo(cmd.ProcessState, time.Since(start)),
+	}
+	buff.release(log, estate.Error != nil)
+	if e.LogFile != nil {
+		e.LogFile.Printf("--- exited: %s", estate.ProcState)
 	}
-	e.reset()
 	return nil, estate
 }
 
+// stopOnCancel waits for ctx to be done, and then stops the command. The
+// process group is sent the cancel signal, and then killed if it hasn't exited
+// once the grace period has passed. The exited channel must be closed once
+// the command has exited.
+func (e *Executor) stopOnCancel(ctx context.Context, cmd *exec.Cmd, exited <-chan struct{}) {
+	select {
+	case <-exited:
+		return
+	case <-ctx.Done():
+	}
+	sig := e.CancelSignal
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	grace := e.Grace
+	if grace == 0 {
+		grace = KillGrace
+	}
+	signalProcess(cmd, sig)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-exited:
+	case <-timer.C:
+		signalProcess(cmd, os.Kill)
+	}
+}
+
+// Signal sends a signal to the process group. Commands run in-process can't be
+// signalled, so they are stopped instead.
 func (e *Executor) Signal(sig os.Signal) error {
 	e.Lock()
 	defer e.Unlock()
 	if !e.running() {
 		return fmt.Errorf("executor not running")
 	}
-	return e.sendSignal(sig)
+	if e.cmd == nil {
+		e.cancel()
+		return nil
+	}
+	return signalProcess(e.cmd, sig)
 }
 
+// Stop kills the process group immediately
 func (e *Executor) Stop() error {
 	return e.Signal(os.Kill)
 }
 
+// Terminate cancels the running command, as if the context passed to
+// RunContext had been cancelled.
+func (e *Executor) Terminate() error {
+	e.Lock()
+	defer e.Unlock()
+	if !e.running() {
+		return fmt.Errorf("executor not running")
+	}
+	e.cancel()
+	return nil
+}
+
 func logOutput(wg *sync.WaitGroup, fp io.ReadCloser, out func(string, ...interface{})) {
 	defer wg.Done()
+	defer fp.Close()
 	r := bufio.NewReader(fp)
 	for {
 		line, _, err := r.ReadLine()
 		if err != nil {
 			return
 		}
-		out("%s", string(line))
+		// Terminals translate line endings to CRLF
+		out("%s", strings.TrimRight(string(line), "\r"))
 	}
 }
 
@@ -186,6 +460,9 @@ func CheckShell(shell string) (string, error) {
 		} else {
 			return "", fmt.Errorf("powershell/pwsh not on path")
 		}
+	case "exec":
+		// Commands are run directly, so there's no shell to look up
+		return "", nil
 	case "modd":
 		// When testing, we're running under a special compiled test executable,
 		// so we look for an instance of modd on our path.
@@ -205,8 +482,14 @@ func makeCommand(shell string, command string, dir string) (*exec.Cmd, error) {
 	}
 	var cmd *exec.Cmd
 	switch shell {
-	case "bash", "sh":
+	case "bash", "fish", "sh", "zsh":
 		cmd = exec.Command(shcmd, "-c", command)
+	case "exec":
+		args, err := splitCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(args[0], args[1:]...)
 	case "modd":
 		cmd = exec.Command(shcmd, "--exec", command)
 	case "powershell":
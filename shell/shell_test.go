@@ -1,6 +1,8 @@
 package shell
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -23,6 +25,12 @@ type cmdTest struct {
 	err     bool
 	procerr bool
 	kill    bool
+
+	timeout  time.Duration
+	timedout bool
+
+	pty       bool
+	inprocess bool
 }
 
 func testCmd(t *testing.T, shell string, ct cmdTest) {
@@ -40,6 +48,10 @@ func testCmd(t *testing.T, shell string, ct cmdTest) {
 			return
 		}
 	}
+	if ct.pty && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("skipping - no pseudo-terminal support")
+		return
+	}
 
 	lt := termlog.NewLogTest()
 	exec, err := NewExecutor(shell, ct.cmd, "")
@@ -47,6 +59,9 @@ func testCmd(t *testing.T, shell string, ct cmdTest) {
 		t.Error(err)
 		return
 	}
+	exec.Timeout = ct.timeout
+	exec.Pty = ct.pty
+	exec.InProcess = ct.inprocess
 	type result struct {
 		err    error
 		pstate *ExecState
@@ -82,6 +97,9 @@ func testCmd(t *testing.T, shell string, ct cmdTest) {
 	if (res.pstate.Error != nil) != ct.procerr {
 		t.Errorf("Unexpected process error: %s, %s", res.pstate.Error, res.pstate.ErrOutput)
 	}
+	if res.pstate.TimedOut != ct.timedout {
+		t.Errorf("Unexpected timeout state: %v", res.pstate.TimedOut)
+	}
 	if ct.buffHas != "" && !strings.Contains(res.pstate.ErrOutput, ct.buffHas) {
 		t.Errorf("Unexpected buffer return: %s", res.pstate.ErrOutput)
 	}
@@ -112,7 +130,7 @@ var shellTests = []cmdTest{
 		cmd:     "echo moddstderr >&2",
 		bufferr: true,
 		buffHas: "moddstderr",
-		shells:  []string{"modd", "sh", "bash"},
+		shells:  []string{"modd", "sh", "bash", "zsh", "fish"},
 	},
 	{
 		name:    "stderr-powershell",
@@ -129,10 +147,40 @@ var shellTests = []cmdTest{
 		kill:    true,
 		procerr: true,
 	},
+	{
+		name:     "timeout",
+		cmd:      "echo moddtest; sleep 999999",
+		logHas:   "moddtest",
+		timeout:  500 * time.Millisecond,
+		procerr:  true,
+		timedout: true,
+	},
+	{
+		name:   "pty",
+		cmd:    "test -t 1 && test -t 2 && echo moddtty",
+		logHas: "moddtty",
+		pty:    true,
+		shells: []string{"sh", "bash", "zsh", "fish"},
+	},
+	{
+		name:    "pty-stderr",
+		cmd:     "echo moddstderr >&2",
+		bufferr: true,
+		buffHas: "moddstderr",
+		pty:     true,
+		shells:  []string{"sh", "bash", "zsh", "fish"},
+	},
 }
 
-func TestShells(t *testing.T) {
+// setShellTesting makes the modd shell run the modd executable on our path for
+// the duration of a test.
+func setShellTesting(t *testing.T) {
 	shellTesting = true
+	t.Cleanup(func() { shellTesting = false })
+}
+
+func TestShells(t *testing.T) {
+	setShellTesting(t)
 
 	var shells []string
 	if runtime.GOOS == "windows" {
@@ -144,6 +192,8 @@ func TestShells(t *testing.T) {
 		shells = []string{
 			"sh",
 			"bash",
+			"zsh",
+			"fish",
 			"modd",
 			"powershell",
 		}
@@ -178,7 +228,7 @@ func TestCaseInsensitivePath(t *testing.T) {
 	os.Unsetenv("PATH")
 	os.Setenv("Path", fmt.Sprintf("%s%ctrigger-text", oldpath, os.PathListSeparator))
 
-	shellTesting = true
+	setShellTesting(t)
 
 	pathTest := cmdTest{
 		name:   "path-test",
@@ -196,3 +246,116 @@ func TestCaseInsensitivePath(t *testing.T) {
 		},
 	)
 }
+
+func TestExitInfo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test commands are POSIX")
+	}
+	tests := []struct {
+		cmd      string
+		exitcode int
+		signal   string
+	}{
+		{"true", 0, ""},
+		{"exit 3", 3, ""},
+		{"kill -TERM $$", -1, "terminated"},
+	}
+	for _, tt := range tests {
+		lt := termlog.NewLogTest()
+		ex, err := NewExecutor("sh", tt.cmd, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err, estate := ex.Run(lt.Log.Stream(""), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estate.ExitCode != tt.exitcode || estate.Signal != tt.signal {
+			t.Errorf(
+				"%q: expected exit code %d signal %q, got %d %q",
+				tt.cmd, tt.exitcode, tt.signal, estate.ExitCode, estate.Signal,
+			)
+		}
+		if estate.WallTime <= 0 {
+			t.Errorf("%q: expected wall time", tt.cmd)
+		}
+		if runtime.GOOS == "linux" && estate.MaxRSS <= 0 {
+			t.Errorf("%q: expected max rss", tt.cmd)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test commands are POSIX")
+	}
+	tests := []struct {
+		name      string
+		cmd       string
+		inprocess bool
+		signal    string
+	}{
+		{"terminate", "echo moddtest; sleep 999999", false, "terminated"},
+		{"escalate", "trap '' TERM; echo moddtest; sleep 999999", false, "killed"},
+		{"inprocess", "echo moddtest; sleep 999999", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := "sh"
+			if tt.inprocess {
+				sh = "modd"
+			}
+			lt := termlog.NewLogTest()
+			ex, err := NewExecutor(sh, tt.cmd, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ex.InProcess = tt.inprocess
+			ex.Grace = 200 * time.Millisecond
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ch := make(chan *ExecState)
+			go func() {
+				err, estate := ex.RunContext(ctx, lt.Log.Stream(""), false)
+				if err != nil {
+					t.Error(err)
+				}
+				ch <- estate
+			}()
+			for !strings.Contains(lt.String(), "moddtest") {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			select {
+			case estate := <-ch:
+				var ce *CancelledError
+				if !errors.As(estate.Error, &ce) || !errors.Is(estate.Error, context.Canceled) {
+					t.Errorf("expected cancellation error, got %v", estate.Error)
+				}
+				if estate.Signal != tt.signal {
+					t.Errorf("expected signal %q, got %q", tt.signal, estate.Signal)
+				}
+				if estate.TimedOut {
+					t.Error("unexpected timeout")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("command was not stopped")
+			}
+			if ex.Running() {
+				t.Error("executor still running")
+			}
+		})
+	}
+
+	// A cancelled context stops the command before it starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ex, err := NewExecutor("sh", "echo moddtest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, estate := ex.RunContext(ctx, termlog.NewLogTest().Log.Stream(""), false)
+	if err != nil || !errors.Is(estate.Error, context.Canceled) {
+		t.Errorf("expected cancellation, got %v %v", err, estate.Error)
+	}
+}
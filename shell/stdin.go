@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"io"
+	"sync"
+)
+
+// StdinRelay forwards input from a reader, usually modd's own stdin, to
+// whichever process is currently attached to it. Input that arrives while no
+// process is attached is discarded.
+type StdinRelay struct {
+	r     io.Reader
+	w     io.WriteCloser
+	eof   bool
+	start sync.Once
+	sync.Mutex
+}
+
+// NewStdinRelay creates a StdinRelay that reads from r
+func NewStdinRelay(r io.Reader) *StdinRelay {
+	return &StdinRelay{r: r}
+}
+
+// Attach makes w the destination for input, replacing any previous
+// destination. If the relay's input has already ended, w is closed
+// immediately.
+func (s *StdinRelay) Attach(w io.WriteCloser) {
+	s.start.Do(func() { go s.run() })
+	s.Lock()
+	defer s.Unlock()
+	if s.eof {
+		w.Close()
+		return
+	}
+	s.w = w
+}
+
+// Detach stops forwarding input to w, if it's the current destination
+func (s *StdinRelay) Detach(w io.WriteCloser) {
+	s.Lock()
+	defer s.Unlock()
+	if s.w == w {
+		s.w = nil
+	}
+}
+
+func (s *StdinRelay) run() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.r.Read(buf)
+		if n > 0 {
+			s.Lock()
+			if s.w != nil {
+				if _, werr := s.w.Write(buf[:n]); werr != nil {
+					s.w = nil
+				}
+			}
+			s.Unlock()
+		}
+		if err != nil {
+			s.Lock()
+			s.eof = true
+			if s.w != nil {
+				s.w.Close()
+				s.w = nil
+			}
+			s.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestStdinRelay(t *testing.T) {
+	setShellTesting(t)
+	r, w := io.Pipe()
+	relay := NewStdinRelay(r)
+
+	lt := termlog.NewLogTest()
+	exec, err := NewExecutor("sh", "read line; echo got:$line", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.Stdin = relay
+	done := make(chan *ExecState)
+	go func() {
+		err, estate := exec.Run(lt.Log.Stream(""), false)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- estate
+	}()
+	// Writes block until the relay has read them, and the relay discards
+	// input until the process is attached, so keep writing until it exits.
+	go func() {
+		for {
+			if _, err := w.Write([]byte("moddtest\n")); err != nil {
+				return
+			}
+		}
+	}()
+	estate := <-done
+	w.Close()
+	if estate.Error != nil {
+		t.Fatalf("unexpected error: %s", estate.Error)
+	}
+	if !strings.Contains(lt.String(), "got:moddtest") {
+		t.Errorf("unexpected output: %s", lt.String())
+	}
+}
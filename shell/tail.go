@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultOutputLimit is the default maximum number of bytes of combined output
+// kept in ExecState.Output
+const DefaultOutputLimit = 4096
+
+// tailBuffer keeps the most recent lines written to it, up to a maximum number
+// of bytes.
+type tailBuffer struct {
+	max   int
+	lines []string
+	size  int
+	sync.Mutex
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	if max <= 0 {
+		max = DefaultOutputLimit
+	}
+	return &tailBuffer{max: max}
+}
+
+// add appends a line, discarding the oldest lines if we're over the limit
+func (t *tailBuffer) add(line string) {
+	t.Lock()
+	defer t.Unlock()
+	line = Tail(line, t.max-1) + "\n"
+	t.lines = append(t.lines, line)
+	t.size += len(line)
+	for t.size > t.max {
+		t.size -= len(t.lines[0])
+		t.lines = t.lines[1:]
+	}
+}
+
+func (t *tailBuffer) String() string {
+	t.Lock()
+	defer t.Unlock()
+	return strings.Join(t.lines, "")
+}
+
+// Tail returns at most the last n bytes of s, without splitting a UTF-8
+// sequence
+func Tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
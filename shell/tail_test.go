@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+var tailTests = []struct {
+	str      string
+	n        int
+	expected string
+}{
+	{"", 3, ""},
+	{"abc", 3, "abc"},
+	{"abcdef", 3, "def"},
+	{"aé", 1, ""},
+	{"aéb", 2, "b"},
+	{"aéb", 3, "éb"},
+}
+
+func TestTail(t *testing.T) {
+	for i, tst := range tailTests {
+		result := Tail(tst.str, tst.n)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := newTailBuffer(8)
+	b.add("one")
+	b.add("two")
+	if b.String() != "one\ntwo\n" {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+	b.add("three")
+	if b.String() != "three\n" {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+	b.add("a long line")
+	if b.String() != "ng line\n" {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+}
+
+func TestExecStateOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping - test commands are POSIX")
+	}
+	cmd := "echo one; echo two >&2; echo three; exit 1"
+	run := func(sh string, limit int) *ExecState {
+		ex, err := NewExecutor(sh, cmd, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex.InProcess = true
+		ex.OutputLimit = limit
+		err, estate := ex.Run(termlog.NewLogTest().Log.Stream(""), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estate.ErrOutput != "two\n" {
+			t.Errorf("%s: unexpected stderr: %q", sh, estate.ErrOutput)
+		}
+		return estate
+	}
+	// Output from an external process arrives on separate pipes, so the order
+	// of lines from stdout and stderr isn't guaranteed
+	estate := run("sh", 0)
+	for _, l := range []string{"one\n", "two\n", "three\n"} {
+		if !strings.Contains(estate.Output, l) {
+			t.Errorf("sh: expected %q in output: %q", l, estate.Output)
+		}
+	}
+	estate = run("modd", 10)
+	if estate.Output != "two\nthree\n" {
+		t.Errorf("modd: unexpected output: %q", estate.Output)
+	}
+}
@@ -0,0 +1,113 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The minimum interval between updates sent to an event stream
+const updateInterval = 200 * time.Millisecond
+
+// Handler returns the HTTP handler for the status page. It serves the page at
+// "/", the state as JSON at "/api/status", and a stream of Server-Sent Events
+// with the state at "/api/events". Requests must be addressed to localhost.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/api/status", s.serveStatus)
+	mux.HandleFunc("/api/events", s.serveEvents)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !localHost(r.Host) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// localHost returns true if a request's Host header names the local machine.
+// Checking it stops other sites from reading the status page through DNS
+// rebinding.
+func localHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1", "[::1]":
+		return true
+	}
+	return false
+}
+
+// Listen starts serving the status page on addr, and returns the address
+// we're listening on.
+func (s *Server) Listen(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, s.Handler())
+	return l.Addr(), nil
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(s.State())
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	changed := make(chan struct{}, 1)
+	s.Lock()
+	s.watchers[changed] = true
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.watchers, changed)
+		s.Unlock()
+	}()
+
+	for {
+		data, err := json.Marshal(s.State())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		// Wait before checking for changes, so that bursts of output are
+		// sent as a single update
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(updateInterval):
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
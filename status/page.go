@@ -0,0 +1,137 @@
+package status
+
+// The status page, which renders the state each time it's sent on the event
+// stream
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>modd</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 1.5em; color: #222; }
+h1 { font-size: 1.3em; }
+h2 { font-size: 1.1em; margin: 0 0 0.4em 0; font-family: monospace; }
+.block { border: 1px solid #ddd; border-radius: 4px; padding: 0.8em; margin-bottom: 1em; }
+.status { font-weight: bold; }
+.ok, .running { color: #2a8a2a; }
+.failed, .timed-out { color: #c62828; }
+.backoff { color: #b8860b; }
+.stopped, .none { color: #888; }
+.detail { color: #666; font-size: 0.9em; }
+ul { list-style: none; padding-left: 0.5em; margin: 0.3em 0; }
+code { font-size: 0.9em; }
+pre { background: #f6f6f6; padding: 0.5em; max-height: 20em; overflow: auto; font-size: 0.85em; margin: 0.3em 0; }
+details summary { cursor: pointer; color: #666; font-size: 0.9em; }
+#conn { color: #888; font-size: 0.8em; }
+</style>
+</head>
+<body>
+<h1>modd: <span id="status" class="status"></span> <span id="conn"></span></h1>
+<div id="blocks"></div>
+<script>
+function el(tag, cls, text) {
+	var e = document.createElement(tag);
+	if (cls) e.className = cls;
+	if (text !== undefined) e.textContent = text;
+	return e;
+}
+
+function statusClass(s) {
+	return s ? s.replace(" ", "-") : "none";
+}
+
+function ago(t) {
+	if (!t) return "";
+	var s = Math.max(0, (Date.now() - new Date(t).getTime()) / 1000);
+	if (s < 60) return Math.round(s) + "s";
+	if (s < 3600) return Math.round(s / 60) + "m";
+	return Math.round(s / 3600) + "h";
+}
+
+function output(lines, open) {
+	var d = el("details");
+	d.open = open;
+	d.appendChild(el("summary", "", "output (" + lines.length + " lines)"));
+	var pre = el("pre", "", lines.join("\n"));
+	d.appendChild(pre);
+	return d;
+}
+
+// Remember which output sections are open across updates
+var opened = {};
+
+function render(state) {
+	document.getElementById("status").textContent = state.status;
+	document.getElementById("status").className = "status " + statusClass(
+		state.status.indexOf("failed") >= 0 ? "failed" : state.status
+	);
+	var root = document.getElementById("blocks");
+	root.querySelectorAll("details").forEach(function (d) {
+		opened[d.dataset.key] = d.open;
+	});
+	root.textContent = "";
+	state.blocks.forEach(function (b, i) {
+		var div = el("div", "block");
+		var h = el("h2", "", b.name + " ");
+		h.appendChild(el("span", "status " + statusClass(b.status), b.status || "not run"));
+		div.appendChild(h);
+		var detail = [];
+		if (b.exit) detail.push(b.exit);
+		if (b.end) detail.push("took " + b.duration.toFixed(1) + "s", ago(b.end) + " ago");
+		else if (b.start) detail.push("started " + ago(b.start) + " ago");
+		div.appendChild(el("div", "detail", detail.join(", ")));
+
+		if (b.preps.length) {
+			var ul = el("ul");
+			b.preps.forEach(function (p) {
+				var li = el("li");
+				li.appendChild(el("span", "status " + statusClass(p.status), (p.status || "-") + " "));
+				li.appendChild(el("code", "", "prep: " + p.command));
+				ul.appendChild(li);
+			});
+			div.appendChild(ul);
+		}
+		if (b.output.length) {
+			var o = output(b.output, opened["b:" + i] || false);
+			o.dataset.key = "b:" + i;
+			div.appendChild(o);
+		}
+		if (b.daemons.length) {
+			var ul = el("ul");
+			b.daemons.forEach(function (d) {
+				var li = el("li");
+				li.appendChild(el("span", "status " + statusClass(d.status), (d.status || "-") + " "));
+				li.appendChild(el("code", "", "daemon: " + d.command));
+				var detail = [];
+				if (d.status == "running") detail.push("up " + ago(d.since));
+				else if (d.exit) detail.push(d.exit);
+				if (d.status == "backoff") detail.push("restarting in " + d.delay + "s");
+				if (d.restarts) detail.push("restarts " + d.restarts);
+				li.appendChild(el("span", "detail", " " + detail.join(", ")));
+				if (d.output.length) {
+					var key = "d:" + i + ":" + d.name;
+					var o = output(d.output, opened[key] || false);
+					o.dataset.key = key;
+					li.appendChild(o);
+				}
+				ul.appendChild(li);
+			});
+			div.appendChild(ul);
+		}
+		root.appendChild(div);
+	});
+}
+
+var conn = document.getElementById("conn");
+var events = new EventSource("api/events");
+events.addEventListener("status", function (e) {
+	conn.textContent = "";
+	render(JSON.parse(e.data));
+});
+events.onerror = function () {
+	conn.textContent = "(disconnected)";
+};
+</script>
+</body>
+</html>
+`
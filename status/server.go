@@ -0,0 +1,309 @@
+// Package status serves a web page and JSON API describing the status of
+// modd's blocks and daemons, with live updates through Server-Sent Events.
+package status
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+)
+
+// The maximum number of lines of output kept for each block and daemon
+const maxOutput = 200
+
+// A Command describes a prep or daemon in the config file
+type Command struct {
+	Name    string
+	Command string
+}
+
+// A Block describes a block in the config file
+type Block struct {
+	Name    string
+	Preps   []Command
+	Daemons []Command
+}
+
+// PrepState is the outcome of a prep in the block's last run
+type PrepState struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Status is "ok", "failed", "timed out", or empty if the prep didn't run
+	Status string `json:"status"`
+}
+
+// DaemonState is the state of a daemon
+type DaemonState struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Status is "running", "backoff", "stopped", or empty if the daemon hasn't
+	// started
+	Status   string     `json:"status"`
+	Since    *time.Time `json:"since,omitempty"` // When the status last changed
+	Restarts int        `json:"restarts"`
+	Exit     string     `json:"exit,omitempty"`  // Exit status of the last run
+	Delay    float64    `json:"delay,omitempty"` // Seconds until the daemon restarts
+	Output   []string   `json:"output"`
+}
+
+// BlockState is the state of a block
+type BlockState struct {
+	Name string `json:"name"`
+	// Status is "running", "ok", "failed", "timed out", or empty if the block
+	// hasn't run
+	Status   string         `json:"status"`
+	Start    *time.Time     `json:"start,omitempty"` // When the last run started
+	End      *time.Time     `json:"end,omitempty"`   // When the last run finished
+	Duration float64        `json:"duration"`        // Duration of the last run in seconds
+	Exit     string         `json:"exit,omitempty"`  // Exit status of the failed prep
+	Preps    []*PrepState   `json:"preps"`
+	Daemons  []*DaemonState `json:"daemons"`
+	Output   []string       `json:"output"`
+}
+
+// State is modd's status, as served by the JSON API
+type State struct {
+	Status string        `json:"status"`
+	Blocks []*BlockState `json:"blocks"`
+}
+
+// Server tracks the status of blocks and daemons from modd's events and
+// output. It's a notify.StatusNotifier, and serves the status over HTTP.
+type Server struct {
+	blocks []*BlockState
+	// Channels notified when the state changes, for event streams
+	watchers map[chan struct{}]bool
+	sync.Mutex
+}
+
+// New creates a Server
+func New() *Server {
+	return &Server{watchers: map[chan struct{}]bool{}}
+}
+
+// blockKey identifies a block across configurations. Block names aren't
+// unique, so blocks are identified by their position too.
+func blockKey(i int, name string) string {
+	return strconv.Itoa(i) + "\x00" + name
+}
+
+// Configure sets the blocks and daemons in the config. Blocks and daemons
+// that are in the previous configuration, at the same position, keep their
+// state and output.
+func (s *Server) Configure(blocks []Block) {
+	s.Lock()
+	defer s.Unlock()
+	oldBlocks := map[string]*BlockState{}
+	oldDaemons := map[string]*DaemonState{}
+	for i, b := range s.blocks {
+		oldBlocks[blockKey(i, b.Name)] = b
+		for _, d := range b.Daemons {
+			oldDaemons[blockKey(i, b.Name)+"\x00"+d.Name] = d
+		}
+	}
+	s.blocks = nil
+	for i, b := range blocks {
+		bs := &BlockState{Name: b.Name, Output: []string{}}
+		if prev, ok := oldBlocks[blockKey(i, b.Name)]; ok {
+			*bs = *prev
+		}
+		bs.Preps = []*PrepState{}
+		for _, p := range b.Preps {
+			bs.Preps = append(bs.Preps, &PrepState{Name: p.Name, Command: p.Command})
+		}
+		bs.Daemons = []*DaemonState{}
+		for _, d := range b.Daemons {
+			ds, ok := oldDaemons[blockKey(i, b.Name)+"\x00"+d.Name]
+			if !ok {
+				ds = &DaemonState{Name: d.Name, Output: []string{}}
+			}
+			ds.Command = d.Command
+			bs.Daemons = append(bs.Daemons, ds)
+		}
+		s.blocks = append(s.blocks, bs)
+	}
+	s.changed()
+}
+
+// changed notifies event streams that the state has changed. The lock must be
+// held.
+func (s *Server) changed() {
+	for w := range s.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) findBlock(i int) *BlockState {
+	if i < 0 || i >= len(s.blocks) {
+		return nil
+	}
+	return s.blocks[i]
+}
+
+func (s *Server) findDaemon(block int, name string) *DaemonState {
+	if b := s.findBlock(block); b != nil {
+		for _, d := range b.Daemons {
+			if d.Name == name {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// RecordOutput adds a line of a command's output to the output of the block
+// with the given index, or of the daemon if kind is "daemon".
+func (s *Server) RecordOutput(block int, kind string, name string, text string) {
+	s.Lock()
+	defer s.Unlock()
+	var output *[]string
+	if kind == "daemon" {
+		if d := s.findDaemon(block, name); d != nil {
+			output = &d.Output
+		}
+	} else if b := s.findBlock(block); b != nil {
+		output = &b.Output
+	}
+	if output == nil {
+		return
+	}
+	appendOutput(output, text)
+	s.changed()
+}
+
+// appendOutput adds text to an output buffer, keeping at most maxOutput lines
+func appendOutput(output *[]string, text string) {
+	text = notify.StripEscapes(text)
+	*output = append(*output, strings.Split(strings.TrimSuffix(text, "\n"), "\n")...)
+	if len(*output) > maxOutput {
+		*output = append([]string(nil), (*output)[len(*output)-maxOutput:]...)
+	}
+}
+
+// Push implements notify.Notifier. Plain notifications aren't shown.
+func (s *Server) Push(title string, text string, icon string) {}
+
+// PushEvent implements notify.EventNotifier
+func (s *Server) PushEvent(e notify.Event) {
+	s.Lock()
+	defer s.Unlock()
+	switch e.Type {
+	case notify.Start:
+		if b := s.findBlock(e.BlockIndex); b != nil {
+			start := e.Start
+			b.Status = "running"
+			b.Start = &start
+			b.End = nil
+			b.Duration = 0
+			b.Exit = ""
+			for _, p := range b.Preps {
+				p.Status = ""
+			}
+		}
+	case notify.Failure, notify.Timeout:
+		if b := s.findBlock(e.BlockIndex); b != nil {
+			status := "failed"
+			if e.Type == notify.Timeout {
+				status = "timed out"
+			}
+			b.Status = status
+			b.Exit = e.ExitMessage()
+			s.finish(b, e.End)
+			// Preps before the one that failed succeeded, unless they were
+			// +noerr preps that failed earlier
+			for _, p := range b.Preps {
+				if p.Status == "" && p.Name == e.Name {
+					p.Status = status
+					break
+				} else if p.Status == "" {
+					p.Status = "ok"
+				}
+			}
+		}
+	case notify.Success, notify.Recovery:
+		if b := s.findBlock(e.BlockIndex); b != nil {
+			b.Status = "ok"
+			s.finish(b, e.End)
+			for _, p := range b.Preps {
+				if p.Status == "" {
+					p.Status = "ok"
+				}
+			}
+		}
+	case notify.Message:
+		if b := s.findBlock(e.BlockIndex); b != nil {
+			appendOutput(&b.Output, e.Title+": "+e.Text)
+		}
+	case notify.DaemonStart:
+		if d := s.findDaemon(e.BlockIndex, e.Name); d != nil {
+			if d.Status != "" {
+				d.Restarts++
+			}
+			since := e.Start
+			d.Status = "running"
+			d.Since = &since
+			d.Delay = 0
+		}
+	case notify.DaemonExit:
+		if d := s.findDaemon(e.BlockIndex, e.Name); d != nil {
+			since := e.End
+			d.Status = "stopped"
+			if e.Delay > 0 {
+				d.Status = "backoff"
+			}
+			d.Since = &since
+			d.Exit = e.Text
+			d.Delay = e.Delay
+		}
+	}
+	s.changed()
+}
+
+// finish records the end of a block's run
+func (s *Server) finish(b *BlockState, end time.Time) {
+	b.End = &end
+	if b.Start != nil {
+		b.Duration = end.Sub(*b.Start).Seconds()
+	}
+}
+
+// AllEvents implements notify.StatusNotifier
+func (s *Server) AllEvents() {}
+
+func (s *Server) status() string {
+	statuses := []string{}
+	for _, b := range s.blocks {
+		statuses = append(statuses, b.Status)
+	}
+	return notify.Summary(statuses)
+}
+
+// State returns a snapshot of the current state
+func (s *Server) State() State {
+	s.Lock()
+	defer s.Unlock()
+	st := State{Status: s.status(), Blocks: []*BlockState{}}
+	for _, b := range s.blocks {
+		bs := *b
+		bs.Output = append([]string{}, b.Output...)
+		bs.Preps = []*PrepState{}
+		for _, p := range b.Preps {
+			ps := *p
+			bs.Preps = append(bs.Preps, &ps)
+		}
+		bs.Daemons = []*DaemonState{}
+		for _, d := range b.Daemons {
+			ds := *d
+			ds.Output = append([]string{}, d.Output...)
+			bs.Daemons = append(bs.Daemons, &ds)
+		}
+		st.Blocks = append(st.Blocks, &bs)
+	}
+	return st
+}
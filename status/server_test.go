@@ -0,0 +1,235 @@
+package status
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+)
+
+func testServer() *Server {
+	s := New()
+	s.Configure([]Block{
+		{
+			Name: "*.go",
+			Preps: []Command{
+				{Name: "go vet", Command: "go vet ./..."},
+				{Name: "go test", Command: "go test ./..."},
+				{Name: "go build", Command: "go build"},
+			},
+			Daemons: []Command{{Name: "web", Command: "./web"}},
+		},
+		{Name: "*.css"},
+	})
+	return s
+}
+
+func TestState(t *testing.T) {
+	s := testServer()
+	now := time.Now()
+	s.PushEvent(notify.Event{Type: notify.Start, Block: "*.go", Start: now})
+	if s.State().Status != "running" {
+		t.Errorf("unexpected status: %q", s.State().Status)
+	}
+	s.RecordOutput(0, "prep", "go test", "\x1b[31mFAIL\x1b[0m: TestFoo\nFAIL")
+	s.PushEvent(notify.Event{
+		Type:     notify.Failure,
+		Block:    "*.go",
+		Name:     "go test",
+		ExitCode: 2,
+		Start:    now,
+		End:      now.Add(2 * time.Second),
+	})
+	s.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "*.go", Name: "web", Start: now})
+	s.PushEvent(notify.Event{
+		Type:  notify.DaemonExit,
+		Block: "*.go",
+		Name:  "web",
+		Text:  "exit status 1",
+		Delay: 1,
+		End:   now,
+	})
+	s.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "*.go", Name: "web", Start: now})
+	s.RecordOutput(0, "daemon", "web", "listening")
+	if s.State().Status != "1 failed" {
+		t.Errorf("unexpected status: %q", s.State().Status)
+	}
+
+	b := s.State().Blocks[0]
+	if b.Status != "failed" || b.Exit != "exit status 2" || b.Duration != 2 {
+		t.Errorf("unexpected block state: %#v", b)
+	}
+	preps := []string{}
+	for _, p := range b.Preps {
+		preps = append(preps, p.Status)
+	}
+	if strings.Join(preps, ",") != "ok,failed," {
+		t.Errorf("unexpected prep states: %q", preps)
+	}
+	if strings.Join(b.Output, "|") != "FAIL: TestFoo|FAIL" {
+		t.Errorf("unexpected block output: %q", b.Output)
+	}
+	d := b.Daemons[0]
+	if d.Status != "running" || d.Restarts != 1 || d.Exit != "exit status 1" {
+		t.Errorf("unexpected daemon state: %#v", d)
+	}
+	if strings.Join(d.Output, "|") != "listening" {
+		t.Errorf("unexpected daemon output: %q", d.Output)
+	}
+
+	// State survives reconfiguration
+	s.Configure([]Block{{Name: "*.go", Daemons: []Command{{Name: "web", Command: "./web -v"}}}})
+	b = s.State().Blocks[0]
+	if b.Status != "failed" || len(b.Output) != 2 || b.Daemons[0].Restarts != 1 {
+		t.Errorf("state not kept after Configure: %#v", b)
+	}
+	if b.Daemons[0].Command != "./web -v" {
+		t.Errorf("daemon command not updated: %q", b.Daemons[0].Command)
+	}
+}
+
+func TestDuplicateBlockNames(t *testing.T) {
+	s := New()
+	s.Configure([]Block{
+		{Name: "{}", Daemons: []Command{{Name: "a", Command: "./a"}}},
+		{Name: "{}", Daemons: []Command{{Name: "b", Command: "./b"}}},
+	})
+	s.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "{}", BlockIndex: 1, Name: "b"})
+	s.PushEvent(notify.Event{Type: notify.Start, Block: "{}", BlockIndex: 1})
+	s.RecordOutput(1, "prep", "make", "output")
+	st := s.State()
+	if st.Blocks[0].Daemons[0].Status != "" || st.Blocks[1].Daemons[0].Status != "running" {
+		t.Errorf("daemon event went to the wrong block: %#v", st)
+	}
+	if st.Blocks[0].Status != "" || st.Blocks[1].Status != "running" {
+		t.Errorf("block event went to the wrong block: %#v", st)
+	}
+	if len(st.Blocks[0].Output) != 0 || len(st.Blocks[1].Output) != 1 {
+		t.Errorf("output went to the wrong block: %#v", st)
+	}
+
+	// State is only kept for blocks at the same position
+	s.Configure([]Block{{Name: "{}"}, {Name: "*.go"}})
+	if st := s.State(); st.Blocks[0].Status != "" || st.Blocks[1].Status != "" {
+		t.Errorf("unexpected state after Configure: %#v", st)
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	s := testServer()
+	for i := 0; i < maxOutput+10; i++ {
+		s.RecordOutput(1, "prep", "sass", "line")
+	}
+	if n := len(s.State().Blocks[1].Output); n != maxOutput {
+		t.Errorf("expected %d lines of output, got %d", maxOutput, n)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	s := testServer()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected response for page: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	resp, err = http.Get(ts.URL + "/nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %s", resp.Status)
+	}
+
+	s.PushEvent(notify.Event{
+		Type: notify.Success, Block: "*.css", BlockIndex: 1, Start: time.Now(), End: time.Now(),
+	})
+	resp, err = http.Get(ts.URL + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var st State
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != "ok" || len(st.Blocks) != 2 || st.Blocks[1].Status != "ok" {
+		t.Errorf("unexpected state: %#v", st)
+	}
+}
+
+func TestHost(t *testing.T) {
+	h := testServer().Handler()
+	tests := []struct {
+		host   string
+		status int
+	}{
+		{"localhost:8123", http.StatusOK},
+		{"LOCALHOST", http.StatusOK},
+		{"127.0.0.1:8123", http.StatusOK},
+		{"[::1]:8123", http.StatusOK},
+		{"attacker.example:8123", http.StatusForbidden},
+		{"127.0.0.1.example", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%q: expected %d, got %d", tt.host, tt.status, w.Code)
+		}
+	}
+}
+
+// readEvent reads the next status event from an event stream
+func readEvent(t *testing.T, r *bufio.Reader) State {
+	var st State
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(l, "data: ") {
+			if err := json.Unmarshal([]byte(l[len("data: "):]), &st); err != nil {
+				t.Fatal(err)
+			}
+			return st
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := testServer()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+	if st := readEvent(t, r); st.Blocks[0].Status != "" {
+		t.Errorf("unexpected initial state: %#v", st.Blocks[0])
+	}
+	s.PushEvent(notify.Event{Type: notify.Start, Block: "*.go", Start: time.Now()})
+	if st := readEvent(t, r); st.Blocks[0].Status != "running" {
+		t.Errorf("expected update, got %#v", st.Blocks[0])
+	}
+}
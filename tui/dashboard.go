@@ -0,0 +1,448 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+	"github.com/cortesi/termlog"
+)
+
+// The maximum number of lines of output kept for each item
+const maxLines = 5000
+
+// Action types
+const (
+	Trigger = "trigger"
+	Restart = "restart"
+)
+
+// An Action is a request made from the keyboard
+type Action struct {
+	Type string
+	// The index of the block, or -1 to trigger all blocks
+	Block int
+	// The index of the daemon to restart, or -1 for all of the block's daemons
+	Daemon int
+}
+
+// A Block describes a block in the config file
+type Block struct {
+	Name    string
+	Daemons []string // The labels of the block's daemons
+}
+
+type level int
+
+const (
+	say level = iota
+	notice
+	warn
+	shout
+	header
+)
+
+type line struct {
+	level level
+	text  string
+}
+
+// An item is a row in the dashboard - modd itself, a block or a daemon
+type item struct {
+	block  int // The block index, or -1 for modd itself
+	daemon int // The daemon index, or -1 if this is not a daemon
+	name   string
+
+	status  string
+	message string        // Exit status of the last run
+	since   time.Time     // When the status last changed
+	took    time.Duration // Duration of the last block run
+	delay   time.Duration // Time from since until a daemon restarts
+	starts  int
+
+	lines []line
+}
+
+// key identifies an item across configurations. Block names aren't unique,
+// so blocks are identified by their position too.
+func (it *item) key() string {
+	if it.daemon >= 0 {
+		return fmt.Sprintf("daemon\x00%d\x00%s", it.block, it.name)
+	} else if it.block >= 0 {
+		return fmt.Sprintf("block\x00%d\x00%s", it.block, it.name)
+	}
+	return "modd"
+}
+
+// Dashboard is a full-screen terminal display of the status and output of
+// each block and daemon. It's a termlog.TermLog that takes the place of modd's
+// log, and a notify.StatusNotifier that tracks status from modd's events.
+type Dashboard struct {
+	items    []*item
+	selected int
+	scroll   int // Lines scrolled back from the end of the log
+	filter   string
+	editing  bool // The filter is being edited
+	quiet    bool
+	dirty    bool
+	// The height of the log view when last rendered, for paging
+	logHeight int
+
+	actions chan Action
+	// Closed when the user quits
+	quit     chan struct{}
+	quitOnce sync.Once
+	term     *terminal
+	sync.Mutex
+}
+
+// New creates a Dashboard
+func New() *Dashboard {
+	return &Dashboard{
+		items:   []*item{{block: -1, daemon: -1, name: "modd"}},
+		actions: make(chan Action, 16),
+		quit:    make(chan struct{}),
+		dirty:   true,
+	}
+}
+
+// Actions returns the channel on which keyboard actions are delivered
+func (d *Dashboard) Actions() <-chan Action {
+	return d.actions
+}
+
+// Quit returns a channel that's closed when the user quits. Quitting is
+// reported separately from other actions, so that it can be handled while
+// commands are running.
+func (d *Dashboard) Quit() <-chan struct{} {
+	return d.quit
+}
+
+// Configure sets the blocks and daemons shown by the dashboard. Items that
+// are in the previous configuration, in the same block position, keep their
+// status and output.
+func (d *Dashboard) Configure(blocks []Block) {
+	d.Lock()
+	defer d.Unlock()
+	old := map[string]*item{}
+	for _, it := range d.items {
+		old[it.key()] = it
+	}
+	reuse := func(it *item) *item {
+		if prev, ok := old[it.key()]; ok {
+			prev.block, prev.daemon = it.block, it.daemon
+			return prev
+		}
+		return it
+	}
+	items := []*item{d.items[0]}
+	for i, b := range blocks {
+		items = append(items, reuse(&item{block: i, daemon: -1, name: b.Name}))
+		for j, label := range b.Daemons {
+			items = append(items, reuse(&item{block: i, daemon: j, name: label}))
+		}
+	}
+	d.items = items
+	if d.selected >= len(items) {
+		d.selected = len(items) - 1
+	}
+	d.dirty = true
+}
+
+func (d *Dashboard) findBlock(block int) *item {
+	for _, it := range d.items {
+		if block >= 0 && it.block == block && it.daemon < 0 {
+			return it
+		}
+	}
+	return nil
+}
+
+func (d *Dashboard) findDaemon(block int, label string) *item {
+	for _, it := range d.items {
+		if it.daemon >= 0 && it.block == block && it.name == label {
+			return it
+		}
+	}
+	return nil
+}
+
+// appendLine adds output to an item's log. The lock must be held.
+func (d *Dashboard) appendLine(it *item, lvl level, text string) {
+	if d.quiet {
+		return
+	}
+	for _, l := range strings.Split(cleanLine(text), "\n") {
+		it.lines = append(it.lines, line{lvl, l})
+		// Keep the view still if we've scrolled back
+		if d.scroll > 0 && d.items[d.selected] == it {
+			d.scroll++
+		}
+	}
+	if len(it.lines) > maxLines {
+		it.lines = append([]line(nil), it.lines[len(it.lines)-maxLines:]...)
+	}
+	d.dirty = true
+}
+
+func (d *Dashboard) output(it *item, lvl level, format string, args []interface{}) {
+	d.Lock()
+	defer d.Unlock()
+	if it == nil {
+		it = d.items[0]
+	}
+	d.appendLine(it, lvl, fmt.Sprintf(format, args...))
+}
+
+// Say logs a line
+func (d *Dashboard) Say(format string, args ...interface{}) {
+	d.output(nil, say, format, args)
+}
+
+// Notice logs a line with the Notice color
+func (d *Dashboard) Notice(format string, args ...interface{}) {
+	d.output(nil, notice, format, args)
+}
+
+// Warn logs a line with the Warn color
+func (d *Dashboard) Warn(format string, args ...interface{}) {
+	d.output(nil, warn, format, args)
+}
+
+// Shout logs a line with the Shout color
+func (d *Dashboard) Shout(format string, args ...interface{}) {
+	d.output(nil, shout, format, args)
+}
+
+// SayAs discards the line - named logs are not shown in the dashboard
+func (d *Dashboard) SayAs(name string, format string, args ...interface{}) {}
+
+// NoticeAs discards the line - named logs are not shown in the dashboard
+func (d *Dashboard) NoticeAs(name string, format string, args ...interface{}) {}
+
+// WarnAs discards the line - named logs are not shown in the dashboard
+func (d *Dashboard) WarnAs(name string, format string, args ...interface{}) {}
+
+// ShoutAs discards the line - named logs are not shown in the dashboard
+func (d *Dashboard) ShoutAs(name string, format string, args ...interface{}) {}
+
+// Quiet disables all output
+func (d *Dashboard) Quiet() {
+	d.Lock()
+	defer d.Unlock()
+	d.quiet = true
+}
+
+// Group returns a group of lines that are added to modd's log together
+func (d *Dashboard) Group() termlog.Group {
+	return &group{d: d}
+}
+
+// Stream returns a stream that writes to modd's log
+func (d *Dashboard) Stream(header string) termlog.Stream {
+	return &stream{d: d, header: header}
+}
+
+// CommandStream returns the stream for a command's output. Daemon output goes
+// to the daemon's log, and the output of other commands to their block's log.
+func (d *Dashboard) CommandStream(block int, kind string, label string) termlog.Stream {
+	d.Lock()
+	defer d.Unlock()
+	var it *item
+	if kind == "daemon" {
+		it = d.findDaemon(block, label)
+	} else {
+		it = d.findBlock(block)
+	}
+	return &stream{d: d, item: it, header: kind + ": " + label}
+}
+
+// Push implements notify.Notifier
+func (d *Dashboard) Push(title string, text string, icon string) {
+	d.output(nil, notice, "%s: %s", []interface{}{title, text})
+}
+
+// PushEvent implements notify.EventNotifier
+func (d *Dashboard) PushEvent(e notify.Event) {
+	d.Lock()
+	defer d.Unlock()
+	switch e.Type {
+	case notify.Start:
+		if it := d.findBlock(e.BlockIndex); it != nil {
+			it.status = "running"
+			it.since = e.Start
+		}
+	case notify.Success, notify.Recovery, notify.Failure, notify.Timeout:
+		if it := d.findBlock(e.BlockIndex); it != nil {
+			it.status = "ok"
+			it.message = ""
+			if e.Type == notify.Failure {
+				it.status = "failed"
+				it.message = e.ExitMessage()
+			} else if e.Type == notify.Timeout {
+				it.status = "timed out"
+			}
+			it.since = e.End
+			it.took = e.End.Sub(e.Start)
+		}
+	case notify.Message:
+		d.appendLine(d.items[0], notice, e.Title+": "+e.Text)
+	case notify.DaemonStart:
+		if it := d.findDaemon(e.BlockIndex, e.Name); it != nil {
+			it.status = "running"
+			it.since = e.Start
+			it.starts++
+		}
+	case notify.DaemonExit:
+		if it := d.findDaemon(e.BlockIndex, e.Name); it != nil {
+			it.status = "stopped"
+			it.message = e.Text
+			it.since = e.End
+			it.delay = time.Duration(e.Delay * float64(time.Second))
+			if it.delay > 0 {
+				it.status = "backoff"
+			}
+		}
+	}
+	d.dirty = true
+}
+
+// AllEvents implements notify.StatusNotifier
+func (d *Dashboard) AllEvents() {}
+
+func (d *Dashboard) status() string {
+	statuses := []string{}
+	for _, it := range d.items {
+		if it.block >= 0 && it.daemon < 0 {
+			statuses = append(statuses, it.status)
+		}
+	}
+	return notify.Summary(statuses)
+}
+
+// stream is a log stream that writes to an item's log. If the item is nil,
+// output goes to modd's log.
+type stream struct {
+	d      *Dashboard
+	item   *item
+	header string
+	quiet  bool
+}
+
+func (s *stream) output(lvl level, format string, args []interface{}) {
+	if !s.quiet {
+		s.d.output(s.item, lvl, format, args)
+	}
+}
+
+// Say logs a line
+func (s *stream) Say(format string, args ...interface{}) {
+	s.output(say, format, args)
+}
+
+// Notice logs a line with the Notice color
+func (s *stream) Notice(format string, args ...interface{}) {
+	s.output(notice, format, args)
+}
+
+// Warn logs a line with the Warn color
+func (s *stream) Warn(format string, args ...interface{}) {
+	s.output(warn, format, args)
+}
+
+// Shout logs a line with the Shout color
+func (s *stream) Shout(format string, args ...interface{}) {
+	s.output(shout, format, args)
+}
+
+// SayAs discards the line - named logs are not shown in the dashboard
+func (s *stream) SayAs(name string, format string, args ...interface{}) {}
+
+// NoticeAs discards the line - named logs are not shown in the dashboard
+func (s *stream) NoticeAs(name string, format string, args ...interface{}) {}
+
+// WarnAs discards the line - named logs are not shown in the dashboard
+func (s *stream) WarnAs(name string, format string, args ...interface{}) {}
+
+// ShoutAs discards the line - named logs are not shown in the dashboard
+func (s *stream) ShoutAs(name string, format string, args ...interface{}) {}
+
+// Quiet disables output for this stream
+func (s *stream) Quiet() {
+	s.quiet = true
+}
+
+// Header adds the stream's header to the log
+func (s *stream) Header() {
+	s.output(header, "%s", []interface{}{s.header})
+}
+
+// group collects lines, and adds them to modd's log when Done is called
+type group struct {
+	d     *Dashboard
+	lines []line
+	quiet bool
+	sync.Mutex
+}
+
+func (g *group) add(lvl level, format string, args []interface{}) {
+	g.Lock()
+	defer g.Unlock()
+	g.lines = append(g.lines, line{lvl, fmt.Sprintf(format, args...)})
+}
+
+// Say logs a line
+func (g *group) Say(format string, args ...interface{}) {
+	g.add(say, format, args)
+}
+
+// Notice logs a line with the Notice color
+func (g *group) Notice(format string, args ...interface{}) {
+	g.add(notice, format, args)
+}
+
+// Warn logs a line with the Warn color
+func (g *group) Warn(format string, args ...interface{}) {
+	g.add(warn, format, args)
+}
+
+// Shout logs a line with the Shout color
+func (g *group) Shout(format string, args ...interface{}) {
+	g.add(shout, format, args)
+}
+
+// SayAs discards the line - named logs are not shown in the dashboard
+func (g *group) SayAs(name string, format string, args ...interface{}) {}
+
+// NoticeAs discards the line - named logs are not shown in the dashboard
+func (g *group) NoticeAs(name string, format string, args ...interface{}) {}
+
+// WarnAs discards the line - named logs are not shown in the dashboard
+func (g *group) WarnAs(name string, format string, args ...interface{}) {}
+
+// ShoutAs discards the line - named logs are not shown in the dashboard
+func (g *group) ShoutAs(name string, format string, args ...interface{}) {}
+
+// Quiet disables output for this group
+func (g *group) Quiet() {
+	g.Lock()
+	defer g.Unlock()
+	g.quiet = true
+}
+
+// Done adds the group's lines to the log
+func (g *group) Done() {
+	g.Lock()
+	defer g.Unlock()
+	if g.quiet {
+		return
+	}
+	g.d.Lock()
+	defer g.d.Unlock()
+	for _, l := range g.lines {
+		g.d.appendLine(g.d.items[0], l.level, l.text)
+	}
+	g.lines = nil
+}
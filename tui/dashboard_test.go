@@ -0,0 +1,138 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/modd/notify"
+)
+
+func screenText(d *Dashboard, width int, height int, now time.Time) string {
+	d.Lock()
+	defer d.Unlock()
+	return cleanLine(strings.Join(d.render(width, height, now), "\n"))
+}
+
+func TestDashboard(t *testing.T) {
+	d := New()
+	d.Configure([]Block{
+		{Name: "*.go", Daemons: []string{"web", "worker"}},
+		{Name: "*.css"},
+	})
+	now := time.Now()
+
+	d.CommandStream(0, "prep", "go test").Header()
+	d.CommandStream(0, "prep", "go test").Warn("FAIL: TestFoo")
+	d.CommandStream(0, "daemon", "web").Say("listening")
+	d.Notice("modd started")
+
+	d.PushEvent(notify.Event{
+		Type:     notify.Failure,
+		Block:    "*.go",
+		ExitCode: 2,
+		Start:    now.Add(-3 * time.Second),
+		End:      now.Add(-time.Second),
+	})
+	d.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "*.go", Name: "web", Start: now})
+	d.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "*.go", Name: "worker", Start: now})
+	d.PushEvent(notify.Event{
+		Type:  notify.DaemonExit,
+		Block: "*.go",
+		Name:  "worker",
+		Text:  "exit status 1",
+		Delay: 4,
+		End:   now,
+	})
+	d.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "*.go", Name: "web", Start: now})
+	if d.status() != "1 failed" {
+		t.Errorf("unexpected status: %q", d.status())
+	}
+
+	screen := screenText(d, 100, 20, now)
+	for _, s := range []string{
+		"modd: 1 failed",
+		"failed     exit status 2, took 2s, 1s ago",
+		"running    up 0s, restarts 1",
+		"backoff    exit status 1, restarting in 4s",
+		"modd started",
+	} {
+		if !strings.Contains(screen, s) {
+			t.Errorf("expected %q on screen:\n%s", s, screen)
+		}
+	}
+
+	// Select the *.go block, and filter its log
+	d.Lock()
+	d.handleKey("j")
+	d.Unlock()
+	screen = screenText(d, 100, 20, now)
+	if !strings.Contains(screen, "prep: go test") || !strings.Contains(screen, "FAIL: TestFoo") {
+		t.Errorf("expected block output on screen:\n%s", screen)
+	}
+	d.Lock()
+	d.filter = "fail"
+	d.Unlock()
+	screen = screenText(d, 100, 20, now)
+	if strings.Contains(screen, "prep: go test") || !strings.Contains(screen, "FAIL: TestFoo") {
+		t.Errorf("expected filtered output on screen:\n%s", screen)
+	}
+
+	// Items keep their output when the config is reloaded
+	d.Configure([]Block{{Name: "*.go", Daemons: []string{"web"}}})
+	if it := d.findDaemon(0, "web"); it == nil || len(it.lines) != 1 {
+		t.Errorf("expected daemon output to be kept")
+	}
+}
+
+func TestDuplicateBlockNames(t *testing.T) {
+	d := New()
+	d.Configure([]Block{
+		{Name: "{}", Daemons: []string{"a"}},
+		{Name: "{}", Daemons: []string{"b"}},
+	})
+	now := time.Now()
+	d.CommandStream(1, "prep", "make").Say("output")
+	d.PushEvent(notify.Event{Type: notify.Start, Block: "{}", BlockIndex: 1, Start: now})
+	d.PushEvent(notify.Event{Type: notify.DaemonStart, Block: "{}", BlockIndex: 1, Name: "b", Start: now})
+
+	first, second := d.findBlock(0), d.findBlock(1)
+	if first.status != "" || len(first.lines) != 0 {
+		t.Errorf("event or output went to the first block: %#v", first)
+	}
+	if second.status != "running" || len(second.lines) != 1 {
+		t.Errorf("expected event and output in the second block: %#v", second)
+	}
+	if it := d.findDaemon(1, "b"); it.status != "running" {
+		t.Errorf("expected the second block's daemon to be running: %#v", it)
+	}
+
+	// Items are only kept for blocks at the same position
+	d.Configure([]Block{{Name: "{}"}, {Name: "*.go"}})
+	if it := d.findBlock(1); it.status != "" {
+		t.Errorf("unexpected item kept after Configure: %#v", it)
+	}
+}
+
+func TestRenderSmall(t *testing.T) {
+	d := New()
+	d.Configure([]Block{{Name: "one"}, {Name: "two"}, {Name: "three"}})
+	for i := 0; i < 100; i++ {
+		d.Say("line")
+	}
+	for _, size := range [][2]int{{1, 1}, {10, 3}, {40, 8}} {
+		d.Lock()
+		screen := d.render(size[0], size[1], time.Now())
+		d.Unlock()
+		if len(screen) != size[1] {
+			t.Errorf("%v: expected %d lines, got %d", size, size[1], len(screen))
+		}
+	}
+}
+
+func TestCleanLine(t *testing.T) {
+	result := cleanLine("\x1b[31mred\x1b[0m\ttab\r\x1b]0;title\x07")
+	if result != "red    tab" {
+		t.Errorf("unexpected result: %q", result)
+	}
+}
@@ -0,0 +1,161 @@
+package tui
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Escape sequences for the keys we handle
+var escapeKeys = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1bOA":  "up",
+	"\x1bOB":  "down",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdown",
+	"\x1b[H":  "home",
+	"\x1b[1~": "home",
+	"\x1bOH":  "home",
+	"\x1b[F":  "end",
+	"\x1b[4~": "end",
+	"\x1bOF":  "end",
+}
+
+// Control characters for the keys we handle
+var controlKeys = map[byte]string{
+	0x03: "ctrl-c",
+	0x04: "ctrl-d",
+	0x08: "backspace",
+	0x0a: "enter",
+	0x0d: "enter",
+	0x15: "ctrl-u",
+	0x7f: "backspace",
+}
+
+// parseKeys splits input read from the terminal into keys. Printable
+// characters are returned as themselves, and other keys by name. Unknown
+// escape sequences and control characters are ignored.
+func parseKeys(b []byte) []string {
+	keys := []string{}
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b:
+			n := escapeLength(b)
+			if n == 1 {
+				keys = append(keys, "esc")
+			} else if k, ok := escapeKeys[string(b[:n])]; ok {
+				keys = append(keys, k)
+			}
+			b = b[n:]
+		case b[0] < 0x20 || b[0] == 0x7f:
+			if k, ok := controlKeys[b[0]]; ok {
+				keys = append(keys, k)
+			}
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			if unicode.IsPrint(r) {
+				keys = append(keys, string(r))
+			}
+			b = b[n:]
+		}
+	}
+	return keys
+}
+
+// escapeLength returns the length of the escape sequence at the start of b
+func escapeLength(b []byte) int {
+	if len(b) < 2 {
+		return 1
+	}
+	switch b[1] {
+	case '[':
+		// A CSI sequence ends with a byte in the range 0x40-0x7e
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(b)
+	case 'O':
+		if len(b) < 3 {
+			return len(b)
+		}
+		return 3
+	}
+	return 1
+}
+
+// action sends an action, dropping it if the queue is full
+func (d *Dashboard) action(a Action) {
+	select {
+	case d.actions <- a:
+	default:
+	}
+}
+
+// handleKey updates the dashboard in response to a key. The lock must be
+// held.
+func (d *Dashboard) handleKey(k string) {
+	d.dirty = true
+	if d.editing {
+		switch k {
+		case "enter":
+			d.editing = false
+		case "esc", "ctrl-c":
+			d.editing = false
+			d.filter = ""
+		case "backspace":
+			if n := len(d.filter); n > 0 {
+				_, size := utf8.DecodeLastRuneInString(d.filter)
+				d.filter = d.filter[:n-size]
+			}
+		default:
+			if utf8.RuneCountInString(k) == 1 {
+				d.filter += k
+			}
+		}
+		d.scroll = 0
+		return
+	}
+	page := d.logHeight - 1
+	if page < 1 {
+		page = 1
+	}
+	it := d.items[d.selected]
+	switch k {
+	case "q", "ctrl-c":
+		d.quitOnce.Do(func() { close(d.quit) })
+	case "up", "k":
+		if d.selected > 0 {
+			d.selected--
+			d.scroll = 0
+		}
+	case "down", "j":
+		if d.selected < len(d.items)-1 {
+			d.selected++
+			d.scroll = 0
+		}
+	case "pgup", "ctrl-u":
+		d.scroll += page
+	case "pgdown", "ctrl-d":
+		d.scroll -= page
+		if d.scroll < 0 {
+			d.scroll = 0
+		}
+	case "home", "g":
+		d.scroll = len(it.lines)
+	case "end", "G":
+		d.scroll = 0
+	case "/":
+		d.editing = true
+	case "esc":
+		d.filter = ""
+	case "t":
+		d.action(Action{Type: Trigger, Block: it.block, Daemon: -1})
+	case "r":
+		if it.block >= 0 {
+			d.action(Action{Type: Restart, Block: it.block, Daemon: it.daemon})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseKeysTests = []struct {
+	input    string
+	expected []string
+}{
+	{"jk", []string{"j", "k"}},
+	{"\x1b[A\x1b[B", []string{"up", "down"}},
+	{"\x1bOA", []string{"up"}},
+	{"\x1b[5~\x1b[6~", []string{"pgup", "pgdown"}},
+	{"\x1b", []string{"esc"}},
+	{"\x1b[1;5C", []string{}},
+	{"a\x7f\r", []string{"a", "backspace", "enter"}},
+	{"\x03", []string{"ctrl-c"}},
+	{"é", []string{"é"}},
+}
+
+func TestParseKeys(t *testing.T) {
+	for i, tst := range parseKeysTests {
+		result := parseKeys([]byte(tst.input))
+		if !reflect.DeepEqual(result, tst.expected) {
+			t.Errorf("Test %d: expected %q, got %q", i, tst.expected, result)
+		}
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	d := New()
+	d.Configure([]Block{{Name: "one", Daemons: []string{"web"}}})
+	next := func() Action {
+		select {
+		case a := <-d.Actions():
+			return a
+		default:
+			return Action{}
+		}
+	}
+
+	d.handleKey("t")
+	if a := next(); a != (Action{Type: Trigger, Block: -1, Daemon: -1}) {
+		t.Errorf("unexpected action: %#v", a)
+	}
+	d.handleKey("r")
+	if a := next(); a.Type != "" {
+		t.Errorf("unexpected action: %#v", a)
+	}
+	d.handleKey("j")
+	d.handleKey("t")
+	if a := next(); a != (Action{Type: Trigger, Block: 0, Daemon: -1}) {
+		t.Errorf("unexpected action: %#v", a)
+	}
+	d.handleKey("down")
+	d.handleKey("down")
+	d.handleKey("r")
+	if a := next(); a != (Action{Type: Restart, Block: 0, Daemon: 0}) {
+		t.Errorf("unexpected action: %#v", a)
+	}
+	d.handleKey("q")
+	d.handleKey("ctrl-c")
+	select {
+	case <-d.Quit():
+	default:
+		t.Error("expected quit")
+	}
+
+	for _, k := range []string{"/", "e", "r", "x", "backspace", "enter"} {
+		d.handleKey(k)
+	}
+	if d.filter != "er" || d.editing {
+		t.Errorf("unexpected filter state: %q %v", d.filter, d.editing)
+	}
+	d.handleKey("esc")
+	if d.filter != "" {
+		t.Errorf("expected filter to be cleared, got %q", d.filter)
+	}
+}
@@ -0,0 +1,249 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cortesi/modd/notify"
+)
+
+// ANSI styles
+const (
+	reset   = "\x1b[0m"
+	bold    = "\x1b[1m"
+	dim     = "\x1b[2m"
+	inverse = "\x1b[7m"
+	red     = "\x1b[31m"
+	green   = "\x1b[32m"
+	yellow  = "\x1b[33m"
+	blue    = "\x1b[34m"
+	cyan    = "\x1b[1;36m"
+)
+
+const helpText = "↑/↓ select  t trigger  r restart  / filter  PgUp/PgDn scroll  q quit"
+
+// cleanLine removes escape sequences and control characters from a line of
+// output, so that we can measure and truncate it.
+func cleanLine(s string) string {
+	s = notify.StripEscapes(s)
+	s = strings.ReplaceAll(s, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// fit truncates or pads s to exactly width runes
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// truncate shortens s to at most width runes
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) > width {
+		return string([]rune(s)[:width])
+	}
+	return s
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "ok", "running":
+		return green
+	case "failed", "timed out":
+		return red
+	case "backoff":
+		return yellow
+	}
+	return dim
+}
+
+// detail describes an item's status in more detail
+func (it *item) detail(now time.Time) string {
+	if it.daemon >= 0 {
+		parts := []string{}
+		switch it.status {
+		case "running":
+			parts = append(parts, "up "+formatDuration(now.Sub(it.since)))
+		case "backoff":
+			wait := it.since.Add(it.delay).Sub(now)
+			if wait < 0 {
+				wait = 0
+			}
+			parts = append(parts, it.message, "restarting in "+formatDuration(wait))
+		case "stopped":
+			parts = append(parts, it.message)
+		}
+		if it.starts > 1 {
+			parts = append(parts, fmt.Sprintf("restarts %d", it.starts-1))
+		}
+		return strings.Join(parts, ", ")
+	}
+	switch it.status {
+	case "running":
+		return "for " + formatDuration(now.Sub(it.since))
+	case "":
+		return ""
+	}
+	parts := []string{}
+	if it.message != "" {
+		parts = append(parts, it.message)
+	}
+	parts = append(
+		parts,
+		"took "+formatDuration(it.took),
+		formatDuration(now.Sub(it.since))+" ago",
+	)
+	return strings.Join(parts, ", ")
+}
+
+// visibleLines returns the selected item's log lines that match the filter
+func (d *Dashboard) visibleLines() []line {
+	lines := d.items[d.selected].lines
+	if d.filter == "" {
+		return lines
+	}
+	filter := strings.ToLower(d.filter)
+	ret := []line{}
+	for _, l := range lines {
+		if strings.Contains(strings.ToLower(l.text), filter) {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
+
+// render returns the lines of the screen for a terminal of the given size.
+// The lock must be held.
+func (d *Dashboard) render(width int, height int, now time.Time) []string {
+	screen := []string{}
+	add := func(s string) {
+		if len(screen) < height {
+			screen = append(screen, s)
+		}
+	}
+	add(inverse + bold + fit(" modd: "+d.status(), width) + reset)
+
+	// The list of items takes at most half of the screen, and scrolls to
+	// keep the selection visible.
+	listHeight := len(d.items)
+	if limit := (height - 3) / 2; listHeight > limit {
+		listHeight = limit
+	}
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	first := 0
+	if d.selected >= listHeight {
+		first = d.selected - listHeight + 1
+	}
+	nameWidth := 0
+	for _, it := range d.items {
+		w := utf8.RuneCountInString(it.name)
+		if it.daemon >= 0 {
+			w += 2
+		}
+		if w > nameWidth {
+			nameWidth = w
+		}
+	}
+	if nameWidth > width/3 {
+		nameWidth = width / 3
+	}
+	for i := first; i < first+listHeight && i < len(d.items); i++ {
+		it := d.items[i]
+		name := it.name
+		if it.daemon >= 0 {
+			name = "  " + name
+		}
+		name = fit(name, nameWidth)
+		marker := "  "
+		if i == d.selected {
+			marker = "▶ "
+			name = inverse + name + reset
+		}
+		status := it.status
+		if it.block < 0 {
+			status = ""
+		}
+		rest := truncate(it.detail(now), width-nameWidth-14)
+		add(
+			marker + name + " " +
+				statusColor(it.status) + fit(status, 10) + reset + " " +
+				dim + rest + reset,
+		)
+	}
+
+	lines := d.visibleLines()
+	title := "── " + d.items[d.selected].name + " "
+	if d.filter != "" {
+		title += "── filter: " + d.filter + " "
+	}
+	d.logHeight = height - len(screen) - 2
+	if d.logHeight < 0 {
+		d.logHeight = 0
+	}
+	if limit := len(lines) - d.logHeight; d.scroll > limit {
+		d.scroll = limit
+	}
+	if d.scroll < 0 {
+		d.scroll = 0
+	}
+	if d.scroll > 0 {
+		title += fmt.Sprintf("── %d more ", d.scroll)
+	}
+	add(dim + truncate(title+strings.Repeat("─", width), width) + reset)
+
+	end := len(lines) - d.scroll
+	start := end - d.logHeight
+	if start < 0 {
+		start = 0
+	}
+	for _, l := range lines[start:end] {
+		add(levelColor(l.level) + truncate(l.text, width) + reset)
+	}
+	for len(screen) < height-1 {
+		add("")
+	}
+	if d.editing {
+		add(truncate("filter: "+d.filter+"█", width))
+	} else {
+		add(dim + truncate(helpText, width) + reset)
+	}
+	return screen
+}
+
+func levelColor(lvl level) string {
+	switch lvl {
+	case notice:
+		return blue
+	case warn:
+		return yellow
+	case shout:
+		return red
+	case header:
+		return cyan
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// How often we check whether the screen needs to be redrawn
+	drawInterval = 100 * time.Millisecond
+	// How often we redraw the screen regardless, to update times
+	refreshInterval = time.Second
+)
+
+// terminal holds the state of the terminal while the dashboard is shown
+type terminal struct {
+	in       *os.File
+	out      *os.File
+	state    *term.State
+	done     chan struct{}
+	drawDone chan struct{}
+	once     sync.Once
+}
+
+// Start takes over the terminal and shows the dashboard. The terminal is
+// restored by Close.
+func (d *Dashboard) Start() error {
+	t := &terminal{
+		in:       os.Stdin,
+		out:      os.Stdout,
+		done:     make(chan struct{}),
+		drawDone: make(chan struct{}),
+	}
+	if !term.IsTerminal(int(t.in.Fd())) || !term.IsTerminal(int(t.out.Fd())) {
+		return fmt.Errorf("the dashboard requires a terminal")
+	}
+	state, err := term.MakeRaw(int(t.in.Fd()))
+	if err != nil {
+		return err
+	}
+	t.state = state
+	// Switch to the alternate screen, and hide the cursor
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+	d.Lock()
+	d.term = t
+	d.Unlock()
+	go d.readInput(t.in)
+	go d.drawLoop(t)
+	return nil
+}
+
+// Close restores the terminal. It's safe to call Close more than once, or if
+// the dashboard was never started.
+func (d *Dashboard) Close() {
+	d.Lock()
+	t := d.term
+	d.Unlock()
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		close(t.done)
+		<-t.drawDone
+		fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+		term.Restore(int(t.in.Fd()), t.state)
+	})
+}
+
+func (d *Dashboard) readInput(r io.Reader) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		d.Lock()
+		for _, k := range parseKeys(buf[:n]) {
+			d.handleKey(k)
+		}
+		d.Unlock()
+	}
+}
+
+func (d *Dashboard) drawLoop(t *terminal) {
+	defer close(t.drawDone)
+	ticker := time.NewTicker(drawInterval)
+	defer ticker.Stop()
+	var width, height int
+	var last time.Time
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+		w, h, err := term.GetSize(int(t.out.Fd()))
+		if err != nil {
+			continue
+		}
+		d.Lock()
+		if !d.dirty && w == width && h == height && time.Since(last) < refreshInterval {
+			d.Unlock()
+			continue
+		}
+		width, height, last = w, h, time.Now()
+		screen := d.render(width, height, last)
+		d.dirty = false
+		d.Unlock()
+
+		buf := bytes.Buffer{}
+		for i, l := range screen {
+			fmt.Fprintf(&buf, "\x1b[%d;1H%s%s\x1b[K", i+1, l, reset)
+		}
+		t.out.Write(buf.Bytes())
+	}
+}
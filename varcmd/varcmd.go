@@ -27,12 +27,40 @@ func getDirs(paths []string) []string {
 
 // quotePath quotes a path for use on the command-line. The path must be in
 // slash-delimited format, and the quoted path will use the native OS separator.
-// FIXME: This is actually dependent on the shell used.
 func quotePath(path string) string {
 	path = strings.Replace(path, "\"", "\\\"", -1)
 	return "\"" + path + "\""
 }
 
+// quotePathFor quotes a path for use on the command-line of the given shell
+func quotePathFor(shell string, path string) string {
+	switch shell {
+	case "fish", "powershell":
+		return QuoteFor(shell, path)
+	}
+	return quotePath(path)
+}
+
+// Quote quotes an arbitrary string so that it is passed to a command as a
+// single, literal argument by a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// QuoteFor quotes an arbitrary string so that it is passed to a command as a
+// single, literal argument by the given shell.
+func QuoteFor(shell string, s string) string {
+	switch shell {
+	case "fish":
+		// Within single quotes, fish only treats \' and \\ specially
+		s = strings.Replace(s, `\`, `\\`, -1)
+		return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+	case "powershell":
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return Quote(s)
+}
+
 // The paths we receive from Go's path manipulation functions are "cleaned",
 // which removes redundancy, but also removes the leading "./" needed by many
 // command-line tools. This function turns cleaned paths into "really relative"
@@ -49,10 +77,10 @@ func realRel(p string) string {
 }
 
 // mkArgs prepares a list of paths for the command line
-func mkArgs(paths []string) string {
+func mkArgs(shell string, paths []string) string {
 	escaped := make([]string, len(paths))
 	for i, s := range paths {
-		escaped[i] = quotePath(realRel(s))
+		escaped[i] = quotePathFor(shell, realRel(s))
 	}
 	return strings.Join(escaped, " ")
 }
@@ -63,6 +91,12 @@ type VarCmd struct {
 	Block    *conf.Block
 	Modified []string
 	Vars     map[string]string
+	// Shell is the shell the command will be run with, which determines how
+	// paths are quoted. If empty, POSIX shell quoting is used.
+	Shell string
+
+	// Cached list of modified files for @mods and @dirmods
+	mods []string
 }
 
 // Get a variable by name
@@ -71,19 +105,21 @@ func (v *VarCmd) get(name string) (string, error) {
 		return val, nil
 	}
 	if (name == "@mods" || name == "@dirmods") && v.Block != nil {
-		var modified []string
-		if v.Modified == nil {
-			var err error
-			modified, err = moddwatch.List(".", v.Block.Include, v.Block.Exclude)
-			if err != nil {
-				return "", err
+		if v.mods == nil {
+			if v.Modified == nil {
+				var err error
+				v.mods, err = moddwatch.List(".", v.Block.Include, v.Block.Exclude)
+				if err != nil {
+					return "", err
+				}
+			} else {
+				v.mods = v.Modified
 			}
-		} else {
-			modified = v.Modified
 		}
-		v.Vars["@mods"] = mkArgs(modified)
-		v.Vars["@dirmods"] = mkArgs(getDirs(modified))
-		return v.Vars[name], nil
+		if name == "@mods" {
+			return mkArgs(v.Shell, v.mods), nil
+		}
+		return mkArgs(v.Shell, getDirs(v.mods)), nil
 	}
 	return "", fmt.Errorf("No such variable: %s", name)
 }
@@ -27,6 +27,25 @@ func TestQuotePath(t *testing.T) {
 	}
 }
 
+var quoteTests = []struct {
+	str      string
+	expected string
+}{
+	{``, `''`},
+	{`one two`, `'one two'`},
+	{`$one "two"`, `'$one "two"'`},
+	{`it's`, `'it'\''s'`},
+}
+
+func TestQuote(t *testing.T) {
+	for i, tst := range quoteTests {
+		result := Quote(tst.str)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected\n%q\ngot\n%q", i, tst.expected, result)
+		}
+	}
+}
+
 var renderTests = []struct {
 	in   string
 	out  string
@@ -44,7 +63,7 @@ var renderTests = []struct {
 func TestRender(t *testing.T) {
 	for _, tt := range renderTests {
 		b := conf.Block{}
-		vc := VarCmd{&b, nil, tt.vars}
+		vc := VarCmd{Block: &b, Vars: tt.vars}
 		ret, err := vc.Render(tt.in)
 		if err != nil {
 			t.Errorf("Unexpected error: %s", err)
@@ -70,7 +89,7 @@ func TestVarCmd(t *testing.T) {
 
 	b := conf.Block{}
 	b.Include = []string{"tdir/**"}
-	vc := VarCmd{&b, nil, map[string]string{}}
+	vc := VarCmd{Block: &b, Vars: map[string]string{}}
 	ret, err := vc.Render("@mods @dirmods")
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
@@ -82,9 +101,9 @@ func TestVarCmd(t *testing.T) {
 	}
 
 	vc = VarCmd{
-		&b,
-		[]string{"foo"},
-		map[string]string{},
+		Block:    &b,
+		Modified: []string{"foo"},
+		Vars:     map[string]string{},
 	}
 	ret, err = vc.Render("@mods @dirmods")
 	if err != nil {
@@ -96,9 +115,59 @@ func TestVarCmd(t *testing.T) {
 	}
 }
 
+var quoteForTests = []struct {
+	shell    string
+	str      string
+	expected string
+}{
+	{"sh", `it's`, `'it'\''s'`},
+	{"zsh", `it's`, `'it'\''s'`},
+	{"fish", `one two`, `'one two'`},
+	{"fish", `it's`, `'it\'s'`},
+	{"fish", `a\b`, `'a\\b'`},
+	{"powershell", `$one`, `'$one'`},
+	{"powershell", `it's`, `'it''s'`},
+}
+
+func TestQuoteFor(t *testing.T) {
+	for i, tst := range quoteForTests {
+		result := QuoteFor(tst.shell, tst.str)
+		if result != tst.expected {
+			t.Errorf("Test %d: expected\n%q\ngot\n%q", i, tst.expected, result)
+		}
+	}
+}
+
+func TestVarCmdShell(t *testing.T) {
+	b := conf.Block{}
+	vc := VarCmd{
+		Block:    &b,
+		Modified: []string{"a/it's"},
+		Vars:     map[string]string{},
+		Shell:    "fish",
+	}
+	ret, err := vc.Render("@mods @dirmods")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `'./a/it\'s' './a'`
+	if ret != expected {
+		t.Errorf("Expected: %#v, got %#v", expected, ret)
+	}
+	vc.Shell = "bash"
+	ret, err = vc.Render("@mods")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = `"./a/it's"`
+	if ret != expected {
+		t.Errorf("Expected: %#v, got %#v", expected, ret)
+	}
+}
+
 func TestRenderErrors(t *testing.T) {
 	b := conf.Block{}
-	vc := VarCmd{&b, nil, map[string]string{}}
+	vc := VarCmd{Block: &b, Vars: map[string]string{}}
 	_, err := vc.Render("@nonexistent")
 	if err == nil {
 		t.Error("Expected error")